@@ -19,16 +19,20 @@ import (
 // CLI represents the command line interface.
 type CLI struct {
 	Globals
-	Server serverCmd `cmd:"" help:"daeira server"`
+	Server  serverCmd       `cmd:"" help:"daeira server"`
+	Admin   king.AdminCmd   `cmd:"" help:"talk to a running daeira server"`
+	Encrypt king.EncryptCmd `cmd:"" help:"encrypt a config value"`
 }
 
 type serverCmd struct {
 	Listen string `help:"server listen address" default:":3001"`
-	Token  string `help:"the token" default:"very_secret"`
+	Token  string `help:"the token" default:"very_secret" sensitive:""`
 }
 
-func (s serverCmd) Run(app *kong.Context, g *Globals, l *zap.SugaredLogger, reg *prometheus.Registry) error {
-	l.Infow("starting server", king.FlagMap(app, regexp.MustCompile("token"), regexp.MustCompile("pw")).Rm(
+func (s serverCmd) Run(app *kong.Context, g *Globals, l *zap.SugaredLogger, reg *prometheus.Registry, b *king.BuildInfo) error {
+	redact := []*regexp.Regexp{regexp.MustCompile("token"), regexp.MustCompile("pw")}
+
+	l.Infow("starting server", king.FlagMap(app, redact...).Rm(
 		"help", "version",
 	).Register(
 		app.Model.Name, reg,
@@ -39,6 +43,16 @@ func (s serverCmd) Run(app *kong.Context, g *Globals, l *zap.SugaredLogger, reg
 	reg.MustRegister(prometheus.NewGoCollector())
 	reg.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
 	r.Method("GET", "/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	r.Method("GET", "/version", king.VersionHandler(b.Version(app.Model.Name)))
+	r.Method("GET", "/debug/config", king.ConfigHandler(app, redact...))
+
+	admin := king.NewAdmin(app, king.WithRedact(redact...))
+
+	go func() {
+		if err := admin.ListenAndServe(); err != nil {
+			l.Errorw("admin socket failed", "err", err)
+		}
+	}()
 
 	server := &http.Server{
 		Addr:    s.Listen,
@@ -56,10 +70,14 @@ func (s serverCmd) Run(app *kong.Context, g *Globals, l *zap.SugaredLogger, reg
 
 // Globals are the gloabal flags.
 type Globals struct {
-	Debug    bool             `help:"enable debug output"`
-	Profiler profilerFlags    `embed:"" prefix:"profiler-"`
-	Version  king.VersionFlag `help:"Show version information"`
-	Show     king.ShowConfig  `help:"Show config file used"`
+	Debug    bool                  `help:"enable debug output"`
+	Profiler profilerFlags         `embed:"" prefix:"profiler-"`
+	Version  king.VersionFlag      `help:"Show version information"`
+	Show     king.ShowConfig       `help:"Show config file used"`
+	EnvHelp  king.EnvHelpFlag      `help:"Show environment variables (--env-help=dotenv for a .env.example file)"`
+	Sample   king.SampleConfigFlag `help:"Print a sample config file"`
+	Schema   king.JSONSchemaFlag   `help:"Print the JSON schema of the config file"`
+	Docs     king.DocsFlag         `help:"Print the reference documentation (man or markdown)"`
 }
 
 type profilerFlags struct {
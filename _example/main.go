@@ -39,9 +39,12 @@ func main() {
 
 	app := kong.Parse(&cli, king.DefaultOptions(
 		king.Config{
-			Name:        appName,
-			Description: "Daeira cli and server.",
-			BuildInfo:   b,
+			Name:            appName,
+			Description:     "Daeira cli and server.",
+			BuildInfo:       b,
+			Completion:      true,
+			ConfigMode:      king.ConfigFlagReplace,
+			SecretProviders: king.DefaultSecretProviders(),
 		},
 	)...)
 
@@ -49,7 +52,7 @@ func main() {
 		cli.Profiler.New(syscall.SIGUSR2).Start()
 	}
 
-	if err := app.Run(&cli.Globals, l, registry); err != nil {
+	if err := app.Run(&cli.Globals, l, registry, b); err != nil {
 		l.Fatal(err)
 	}
 }
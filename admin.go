@@ -0,0 +1,362 @@
+package king
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+const (
+	adminSocketKey = "king_admin_socket"
+	adminTimeout   = 5 * time.Second
+)
+
+// AdminStatus is the runtime information served by Admin.
+type AdminStatus struct {
+	Version  *Version     `json:"version,omitempty" yaml:"version,omitempty"`
+	Configs  []ConfigFile `json:"configs" yaml:"configs"`
+	LogLevel string       `json:"log_level,omitempty" yaml:"log_level,omitempty"`
+	Settings Settings     `json:"settings" yaml:"settings"`
+}
+
+// Admin serves runtime information of a running instance on a unix domain socket.
+//
+// The socket speaks HTTP. Use AdminCmd to talk to a running instance.
+type Admin struct {
+	path     string
+	redact   []*regexp.Regexp
+	logLevel func() string
+	reload   func() error
+	kctx     *kong.Context
+	server   *http.Server
+	listener net.Listener
+}
+
+// AdminOption is an Admin functional option.
+type AdminOption func(*Admin)
+
+// WithSocket sets the path of the unix domain socket. It defaults to the
+// socket configured with Config.AdminSocket.
+func WithSocket(path string) AdminOption {
+	return func(a *Admin) {
+		a.path = path
+	}
+}
+
+// WithRedact sets the regular expressions of flag names whose values are redacted.
+func WithRedact(redactFlags ...*regexp.Regexp) AdminOption {
+	return func(a *Admin) {
+		a.redact = redactFlags
+	}
+}
+
+// WithLogLevel sets the function that reports the current log level.
+func WithLogLevel(l func() string) AdminOption {
+	return func(a *Admin) {
+		a.logLevel = l
+	}
+}
+
+// WithReload sets the function that is called when a reload is requested.
+func WithReload(f func() error) AdminOption {
+	return func(a *Admin) {
+		a.reload = f
+	}
+}
+
+// NewAdmin creates an admin interface for the parsed *kong.Context.
+func NewAdmin(ctx *kong.Context, opts ...AdminOption) *Admin {
+	a := &Admin{
+		path: kong.ExpandPath(ctx.Model.Vars()[adminSocketKey]),
+		kctx: ctx,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", a.status)
+	mux.HandleFunc("POST /reload", a.handleReload)
+
+	if b := newBuildInfo("king_", ctx.Model.Vars()); b != nil {
+		mux.Handle("GET /version", VersionHandler(b.Version(ctx.Model.Name)))
+	}
+
+	mux.Handle("GET /config", ConfigHandler(ctx, a.redact...))
+
+	a.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: adminTimeout,
+	}
+
+	return a
+}
+
+// Path returns the path of the unix domain socket.
+func (a *Admin) Path() string {
+	return a.path
+}
+
+// Listen creates the unix domain socket. A stale socket file is removed,
+// other files are not. The directory of the socket is created if it does
+// not exist, it has to be owned by the user of the process and must not be
+// writable by other users.
+func (a *Admin) Listen() error {
+	if a.path == "" {
+		return errors.New("no admin socket configured")
+	}
+
+	dir := filepath.Dir(a.path)
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	if err := checkSocketDir(dir); err != nil {
+		return err
+	}
+
+	if c, err := net.Dial("unix", a.path); err == nil {
+		c.Close()
+		return fmt.Errorf("admin socket %s is already in use", a.path)
+	}
+
+	info, err := os.Lstat(a.path)
+
+	switch {
+	case err == nil && info.Mode()&os.ModeSocket == 0:
+		return fmt.Errorf("admin socket %s: file exists and is not a socket", a.path)
+	case err == nil:
+		if err := os.Remove(a.path); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	l, err := net.Listen("unix", a.path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(a.path, 0o600); err != nil {
+		l.Close()
+		return err
+	}
+
+	a.listener = l
+
+	return nil
+}
+
+// checkSocketDir returns an error if another user could replace the socket
+// in dir.
+func checkSocketDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !info.IsDir():
+		return fmt.Errorf("admin socket directory %s is not a directory", dir)
+	case !ownedBySelf(info):
+		return fmt.Errorf("admin socket directory %s is owned by another user", dir)
+	case info.Mode().Perm()&0o022 != 0:
+		return fmt.Errorf("admin socket directory %s is writable by other users", dir)
+	}
+
+	return nil
+}
+
+// Serve serves requests until Shutdown is called. Listen has to be called first.
+func (a *Admin) Serve() error {
+	if a.listener == nil {
+		return errors.New("admin socket is not listening")
+	}
+
+	if err := a.server.Serve(a.listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// ListenAndServe calls Listen and Serve.
+func (a *Admin) ListenAndServe() error {
+	if err := a.Listen(); err != nil {
+		return err
+	}
+
+	return a.Serve()
+}
+
+// Shutdown stops the admin interface and removes the socket.
+func (a *Admin) Shutdown(ctx context.Context) error {
+	return a.server.Shutdown(ctx)
+}
+
+func (a *Admin) status(w http.ResponseWriter, r *http.Request) {
+	vars := a.kctx.Model.Vars()
+
+	files, err := EffectiveConfigFiles(a.kctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s := AdminStatus{
+		Configs:  files,
+		Settings: EffectiveSettings(a.kctx, a.redact...),
+	}
+
+	if b := newBuildInfo("king_", vars); b != nil {
+		v := b.Version(a.kctx.Model.Name)
+		s.Version = &v
+	}
+
+	if a.logLevel != nil {
+		s.LogLevel = a.logLevel()
+	}
+
+	write(w, negotiate(r), s)
+}
+
+func (a *Admin) handleReload(w http.ResponseWriter, _ *http.Request) {
+	if a.reload == nil {
+		http.Error(w, "reload is not supported", http.StatusNotImplemented)
+		return
+	}
+
+	if err := a.reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminCmd is a client command that talks to the Admin interface of a running instance.
+//
+//	Usage:
+//	type CLI struct {
+//	    Admin king.AdminCmd `cmd:"" help:"Talk to a running instance."`
+//	}
+type AdminCmd struct {
+	Socket string         `help:"Path of the admin socket." default:"${king_admin_socket}" type:"path"`
+	Status adminStatusCmd `cmd:"" help:"Show status of a running instance."`
+	Reload adminReloadCmd `cmd:"" help:"Reload a running instance."`
+}
+
+type adminStatusCmd struct{}
+
+func (adminStatusCmd) Run(ctx *kong.Context, a *AdminCmd) error {
+	body, err := a.do(http.MethodGet, "/status")
+	if err != nil {
+		return err
+	}
+
+	s := AdminStatus{}
+	if err := json.Unmarshal(body, &s); err != nil {
+		return err
+	}
+
+	printStatus(ctx.Stdout, s)
+
+	return nil
+}
+
+type adminReloadCmd struct{}
+
+func (adminReloadCmd) Run(ctx *kong.Context, a *AdminCmd) error {
+	if _, err := a.do(http.MethodPost, "/reload"); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(ctx.Stdout, "reloaded")
+
+	return nil
+}
+
+func (a *AdminCmd) do(method, path string) ([]byte, error) {
+	c := http.Client{
+		Timeout: adminTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", a.Socket)
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), method, "http://admin"+path, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", contentTypeJSON)
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("%s %s: %s", method, path, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
+
+func printStatus(out io.Writer, s AdminStatus) {
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+
+	if s.Version != nil {
+		fmt.Fprintln(w, s.Version.String())
+		fmt.Fprintln(w)
+	}
+
+	if s.LogLevel != "" {
+		fmt.Fprintf(w, "Log level:\t%s\n\n", s.LogLevel)
+	}
+
+	fmt.Fprintln(w, "Configuration files:")
+
+	writeConfigFiles(w, s.Configs)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Settings:")
+
+	names := make([]string, 0, len(s.Settings))
+	for name := range s.Settings {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\t%v\t(%s)\n", name, s.Settings[name].Value, s.Settings[name].Origin)
+	}
+
+	w.Flush()
+}
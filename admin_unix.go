@@ -0,0 +1,19 @@
+//go:build unix
+
+package king
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedBySelf reports whether the file of info is owned by the user of the
+// process or by root.
+func ownedBySelf(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+
+	return int(st.Uid) == os.Geteuid() || st.Uid == 0
+}
@@ -0,0 +1,464 @@
+package king
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// All supported shells for completion scripts.
+const (
+	Bash = "bash"
+	Zsh  = "zsh"
+	Fish = "fish"
+)
+
+// CompletionFlag prints a shell completion script for bash, zsh or fish.
+//
+//	Usage:
+//	source <(app --completion=bash)
+//
+// DefaultOptions adds it to the application if Config.Completion is set.
+type CompletionFlag string
+
+// Decode implements kong.MapperValue.
+func (c *CompletionFlag) Decode(ctx *kong.DecodeContext) error {
+	v, err := popChoice(ctx, "shell", Bash, Zsh, Fish)
+	if err != nil {
+		return err
+	}
+
+	*c = CompletionFlag(v)
+
+	return nil
+}
+
+// BeforeApply is the actual completion command.
+func (CompletionFlag) BeforeApply(app *kong.Kong, ctx *kong.Context, path *kong.Path) error {
+	shell := parsedFlagValue[CompletionFlag](ctx, path)
+
+	if err := WriteCompletion(app.Stdout, app.Model, string(shell)); err != nil {
+		return err
+	}
+
+	app.Exit(0)
+
+	return nil
+}
+
+type completion struct {
+	Completion CompletionFlag `help:"Print the shell completion script (bash, zsh or fish)." placeholder:"SHELL"`
+}
+
+// WriteCompletion writes the completion script of the application for shell.
+//
+// Subcommands, flags, enum values and paths of flags with type "path",
+// "existingfile" or "existingdir" are completed.
+func WriteCompletion(w io.Writer, app *kong.Application, shell string) error {
+	nodes := completionNodes(app.Node)
+
+	switch shell {
+	case Bash:
+		writeBashCompletion(w, app.Name, nodes)
+	case Zsh:
+		writeZshCompletion(w, app.Name, nodes)
+	case Fish:
+		writeFishCompletion(w, app.Name, nodes)
+	default:
+		return fmt.Errorf("unsupported shell %q", shell)
+	}
+
+	return nil
+}
+
+// completionNode is a command with all its flags, including the flags of
+// its parents, and its direct subcommands.
+type completionNode struct {
+	node     *kong.Node
+	path     []string
+	flags    []*kong.Flag
+	commands []*kong.Node
+}
+
+func (c completionNode) key() string {
+	return strings.Join(c.path, " ")
+}
+
+func completionNodes(root *kong.Node) []completionNode {
+	nodes := []completionNode{}
+
+	var visit func(n *kong.Node, flags []*kong.Flag)
+
+	visit = func(n *kong.Node, flags []*kong.Flag) {
+		for _, f := range n.Flags {
+			if !f.Hidden {
+				flags = append(flags, f)
+			}
+		}
+
+		c := completionNode{
+			node:  n,
+			path:  commandPath(n),
+			flags: flags,
+		}
+
+		for _, child := range n.Children {
+			if child.Type == kong.CommandNode && !child.Hidden {
+				c.commands = append(c.commands, child)
+			}
+		}
+
+		nodes = append(nodes, c)
+
+		for _, child := range c.commands {
+			visit(child, append([]*kong.Flag{}, flags...))
+		}
+	}
+
+	visit(root, nil)
+
+	return nodes
+}
+
+type valueCompletion int
+
+const (
+	completeNothing valueCompletion = iota
+	completeEnum
+	completeFiles
+	completeDirs
+)
+
+func completeValue(f *kong.Flag) valueCompletion {
+	switch {
+	case f.IsBool() || f.IsCounter():
+		return completeNothing
+	case len(enumValues(f)) > 0:
+		return completeEnum
+	case f.Tag.Type == "existingdir":
+		return completeDirs
+	case f.Tag.Type == "path" || f.Tag.Type == "existingfile":
+		return completeFiles
+	}
+
+	return completeNothing
+}
+
+func enumValues(f *kong.Flag) []string {
+	if _, ok := f.Target.Interface().(CompletionFlag); ok {
+		return []string{Bash, Zsh, Fish}
+	}
+
+	if f.Enum == "" {
+		return nil
+	}
+
+	return f.EnumSlice()
+}
+
+// valueFlags returns all flags that take a value, unique by name.
+func valueFlags(nodes []completionNode) []*kong.Flag {
+	flags := []*kong.Flag{}
+	seen := map[string]bool{}
+
+	for _, n := range nodes {
+		for _, f := range n.flags {
+			if seen[f.Name] || f.IsBool() || f.IsCounter() {
+				continue
+			}
+
+			seen[f.Name] = true
+
+			flags = append(flags, f)
+		}
+	}
+
+	return flags
+}
+
+func flagNames(f *kong.Flag) []string {
+	names := []string{"--" + f.Name}
+
+	if f.Short != 0 {
+		names = append(names, "-"+string(f.Short))
+	}
+
+	for _, a := range f.Aliases {
+		names = append(names, "--"+a)
+	}
+
+	return names
+}
+
+func commandNames(n *kong.Node) []string {
+	return append([]string{n.Name}, n.Aliases...)
+}
+
+func shellFunctionName(name string) string {
+	return "_" + strings.Map(func(r rune) rune {
+		if r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+
+		return '_'
+	}, name)
+}
+
+func firstLine(s string) string {
+	l, _, _ := strings.Cut(s, "\n")
+	return l
+}
+
+// singleQuote quotes s for bash, zsh and fish.
+func singleQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func writeBashCompletion(w io.Writer, name string, nodes []completionNode) {
+	fn := shellFunctionName(name) + "_completion"
+
+	fmt.Fprintf(w, "# bash completion for %s\n", name)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintln(w, `    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"`)
+	fmt.Fprintln(w, `    local cmd="" flags="" commands="" i`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `    for ((i = 1; i < COMP_CWORD; i++)); do`)
+	fmt.Fprintln(w, `        case "${cmd}:${COMP_WORDS[i]}" in`)
+
+	for _, n := range nodes {
+		for _, c := range n.commands {
+			for _, cn := range commandNames(c) {
+				fmt.Fprintf(w, "            %s) cmd=%s ;;\n", singleQuote(n.key()+":"+cn), singleQuote(strings.Join(commandPath(c), " ")))
+			}
+		}
+	}
+
+	fmt.Fprintln(w, `        esac`)
+	fmt.Fprintln(w, `    done`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `    case "${prev}" in`)
+
+	for _, f := range valueFlags(nodes) {
+		pattern := strings.Join(flagNames(f), "|")
+
+		switch completeValue(f) {
+		case completeEnum:
+			fmt.Fprintf(w, "        %s) COMPREPLY=($(compgen -W %s -- \"${cur}\")); return ;;\n", pattern, singleQuote(strings.Join(enumValues(f), " ")))
+		case completeFiles:
+			fmt.Fprintf(w, "        %s) COMPREPLY=($(compgen -f -- \"${cur}\")); return ;;\n", pattern)
+		case completeDirs:
+			fmt.Fprintf(w, "        %s) COMPREPLY=($(compgen -d -- \"${cur}\")); return ;;\n", pattern)
+		case completeNothing:
+			fmt.Fprintf(w, "        %s) return ;;\n", pattern)
+		}
+	}
+
+	fmt.Fprintln(w, `    esac`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `    case "${cmd}" in`)
+
+	for _, n := range nodes {
+		flags := []string{}
+		for _, f := range n.flags {
+			flags = append(flags, flagNames(f)...)
+		}
+
+		commands := []string{}
+		for _, c := range n.commands {
+			commands = append(commands, commandNames(c)...)
+		}
+
+		fmt.Fprintf(w, "        %s) flags=%s; commands=%s ;;\n", singleQuote(n.key()), singleQuote(strings.Join(flags, " ")), singleQuote(strings.Join(commands, " ")))
+	}
+
+	fmt.Fprintln(w, `    esac`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `    if [[ "${cur}" == -* ]]; then`)
+	fmt.Fprintln(w, `        COMPREPLY=($(compgen -W "${flags}" -- "${cur}"))`)
+	fmt.Fprintln(w, `    else`)
+	fmt.Fprintln(w, `        COMPREPLY=($(compgen -W "${commands}" -- "${cur}"))`)
+	fmt.Fprintln(w, `    fi`)
+	fmt.Fprintln(w, `}`)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "complete -F %s %s\n", fn, name)
+}
+
+func writeZshCompletion(w io.Writer, name string, nodes []completionNode) {
+	fn := shellFunctionName(name)
+
+	fmt.Fprintf(w, "#compdef %s\n\n", name)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintln(w, `    local cmd="" i`)
+	fmt.Fprintln(w, `    local -a flags commands`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `    for ((i = 2; i < CURRENT; i++)); do`)
+	fmt.Fprintln(w, `        case "${cmd}:${words[i]}" in`)
+
+	for _, n := range nodes {
+		for _, c := range n.commands {
+			for _, cn := range commandNames(c) {
+				fmt.Fprintf(w, "            %s) cmd=%s ;;\n", singleQuote(n.key()+":"+cn), singleQuote(strings.Join(commandPath(c), " ")))
+			}
+		}
+	}
+
+	fmt.Fprintln(w, `        esac`)
+	fmt.Fprintln(w, `    done`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `    case "${words[CURRENT-1]}" in`)
+
+	for _, f := range valueFlags(nodes) {
+		pattern := strings.Join(flagNames(f), "|")
+
+		switch completeValue(f) {
+		case completeEnum:
+			fmt.Fprintf(w, "        %s) compadd -- %s; return ;;\n", pattern, strings.Join(quoteAll(enumValues(f)), " "))
+		case completeFiles:
+			fmt.Fprintf(w, "        %s) _files; return ;;\n", pattern)
+		case completeDirs:
+			fmt.Fprintf(w, "        %s) _files -/; return ;;\n", pattern)
+		case completeNothing:
+			fmt.Fprintf(w, "        %s) return ;;\n", pattern)
+		}
+	}
+
+	fmt.Fprintln(w, `    esac`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `    case "${cmd}" in`)
+
+	for _, n := range nodes {
+		fmt.Fprintf(w, "        %s)\n", singleQuote(n.key()))
+
+		flags := []string{}
+		for _, f := range n.flags {
+			for _, fn := range flagNames(f) {
+				flags = append(flags, singleQuote(fn+":"+zshDescription(f.Help)))
+			}
+		}
+
+		commands := []string{}
+		for _, c := range n.commands {
+			for _, cn := range commandNames(c) {
+				commands = append(commands, singleQuote(cn+":"+zshDescription(c.Help)))
+			}
+		}
+
+		fmt.Fprintf(w, "            flags=(%s)\n", strings.Join(flags, " "))
+		fmt.Fprintf(w, "            commands=(%s)\n", strings.Join(commands, " "))
+		fmt.Fprintln(w, "            ;;")
+	}
+
+	fmt.Fprintln(w, `    esac`)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `    if [[ "${words[CURRENT]}" == -* ]]; then`)
+	fmt.Fprintln(w, `        _describe 'flag' flags`)
+	fmt.Fprintln(w, `    else`)
+	fmt.Fprintln(w, `        _describe 'command' commands`)
+	fmt.Fprintln(w, `    fi`)
+	fmt.Fprintln(w, `}`)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "compdef %s %s\n", fn, name)
+}
+
+func zshDescription(help string) string {
+	return strings.ReplaceAll(firstLine(help), ":", `\:`)
+}
+
+func quoteAll(l []string) []string {
+	q := make([]string, 0, len(l))
+
+	for _, s := range l {
+		q = append(q, singleQuote(s))
+	}
+
+	return q
+}
+
+func writeFishCompletion(w io.Writer, name string, nodes []completionNode) {
+	fmt.Fprintf(w, "# fish completion for %s\n", name)
+	fmt.Fprintf(w, "complete -c %s -f\n", name)
+
+	for _, n := range nodes {
+		condition := fishCondition(n)
+
+		for _, c := range n.commands {
+			for _, cn := range commandNames(c) {
+				fmt.Fprintf(w, "complete -c %s -n %s -a %s -d %s\n", name, singleQuote(condition), singleQuote(cn), singleQuote(firstLine(c.Help)))
+			}
+		}
+
+		for _, f := range n.flags[len(parentFlags(nodes, n)):] {
+			fmt.Fprintf(w, "complete -c %s", name)
+
+			if len(n.path) > 0 {
+				fmt.Fprintf(w, " -n %s", singleQuote(fishSeen(n)))
+			}
+
+			fmt.Fprintf(w, " -l %s", f.Name)
+
+			if f.Short != 0 {
+				fmt.Fprintf(w, " -s %s", string(f.Short))
+			}
+
+			switch completeValue(f) {
+			case completeEnum:
+				fmt.Fprintf(w, " -x -a %s", singleQuote(strings.Join(enumValues(f), " ")))
+			case completeFiles:
+				fmt.Fprint(w, " -r -F")
+			case completeDirs:
+				fmt.Fprint(w, " -x -a '(__fish_complete_directories)'")
+			case completeNothing:
+				if !f.IsBool() && !f.IsCounter() {
+					fmt.Fprint(w, " -x")
+				}
+			}
+
+			fmt.Fprintf(w, " -d %s\n", singleQuote(firstLine(f.Help)))
+		}
+	}
+}
+
+// fishCondition returns the condition under which the subcommands of n are completed.
+func fishCondition(n completionNode) string {
+	if len(n.path) == 0 {
+		return "__fish_use_subcommand"
+	}
+
+	subcommands := []string{}
+	for _, c := range n.commands {
+		subcommands = append(subcommands, commandNames(c)...)
+	}
+
+	return fmt.Sprintf("%s; and not __fish_seen_subcommand_from %s", fishSeen(n), strings.Join(subcommands, " "))
+}
+
+// fishSeen returns the condition that all commands of the path of n were
+// given by their name or one of their aliases.
+func fishSeen(n completionNode) string {
+	seen := []string{}
+
+	for c := n.node; c != nil && c.Type == kong.CommandNode; c = c.Parent {
+		seen = append([]string{"__fish_seen_subcommand_from " + strings.Join(commandNames(c), " ")}, seen...)
+	}
+
+	return strings.Join(seen, "; and ")
+}
+
+// parentFlags returns the flags n inherited from its parent.
+func parentFlags(nodes []completionNode, n completionNode) []*kong.Flag {
+	if len(n.path) == 0 {
+		return nil
+	}
+
+	parent := strings.Join(n.path[:len(n.path)-1], " ")
+
+	for _, p := range nodes {
+		if p.key() == parent {
+			return p.flags
+		}
+	}
+
+	return nil
+}
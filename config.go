@@ -2,9 +2,10 @@ package king
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"text/tabwriter"
 
@@ -19,53 +20,129 @@ const (
 type ShowConfig bool
 
 // BeforeApply is the actual show-config command.
-func (s ShowConfig) BeforeApply(app *kong.Kong, vars kong.Vars) error {
+func (s ShowConfig) BeforeApply(app *kong.Kong, ctx *kong.Context) error {
+	files, err := EffectiveConfigFiles(ctx)
+	if err != nil {
+		return err
+	}
+
 	fmt.Fprintln(app.Stderr, "Configuration files:")
 	w := tabwriter.NewWriter(app.Stderr, 0, 0, 1, ' ', 0)
 
-	for _, f := range Configs(vars) {
-		file := kong.ExpandPath(f)
+	writeConfigFiles(w, files)
+	w.Flush()
+
+	writePrecedence(app.Stderr, app.Model.Vars())
+
+	app.Exit(0)
+
+	return nil
+}
+
+// ConfigFile is a configuration file and its status. Keys are the flags
+// the file provided a value for, Overlay is the environment of an overlay
+// file. The keys of a Policy file are locked, an Embedded file is read
+// from Config.EmbeddedConfig.
+type ConfigFile struct {
+	Path     string   `json:"path" yaml:"path"`
+	Status   string   `json:"status" yaml:"status"`
+	Overlay  string   `json:"overlay,omitempty" yaml:"overlay,omitempty"`
+	Policy   bool     `json:"policy,omitempty" yaml:"policy,omitempty"`
+	Embedded bool     `json:"embedded,omitempty" yaml:"embedded,omitempty"`
+	Keys     []string `json:"keys,omitempty" yaml:"keys,omitempty"`
+}
 
+// All possible configuration file states.
+const (
+	StatusParsed           = "parsed"
+	StatusNotFound         = "not found"
+	StatusPermissionDenied = "permission denied"
+)
+
+// writeConfigFiles writes one line per file with its status and the keys
+// it set. If there are overlays, policies or an embedded file, the layer of
+// each file is written too.
+func writeConfigFiles(w io.Writer, files []ConfigFile) {
+	layers := slices.ContainsFunc(files, func(f ConfigFile) bool {
+		return f.Overlay != "" || f.Policy || f.Embedded
+	})
+
+	for _, f := range files {
+		fmt.Fprintf(w, "  %s\t%s", f.Path, f.Status)
+
+		if layers {
+			layer := "base"
+
+			switch {
+			case f.Policy:
+				layer = "policy (locked)"
+			case f.Embedded:
+				layer = SourceEmbedded
+			case f.Overlay != "":
+				layer = "overlay " + f.Overlay
+			}
+
+			fmt.Fprintf(w, "\t%s", layer)
+		}
+
+		if len(f.Keys) > 0 {
+			fmt.Fprintf(w, "\t%s", strings.Join(f.Keys, ", "))
+		}
+
+		fmt.Fprintln(w)
+	}
+}
+
+// ConfigFiles returns all configured files from kong.Vars and their status.
+// Directories and glob patterns are expanded to the files they contain.
+func ConfigFiles(vars kong.Vars) ([]ConfigFile, error) {
+	files := []ConfigFile{}
+	paths := []string{}
+	ext := FileResolver(vars[fileResolverKey]).extension()
+
+	for _, p := range Configs(vars) {
+		fragments, err := fragments(p, ext)
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, fragments...)
+	}
+
+	for _, file := range paths {
 		f, err := os.Open(filepath.Clean(file))
 		if err != nil {
 			if os.IsNotExist(err) {
-				fmt.Fprintf(w, "  %s\tnot found\n", file)
+				files = append(files, ConfigFile{Path: file, Status: StatusNotFound})
 				continue
 			}
 
 			if os.IsPermission(err) {
-				fmt.Fprintf(w, "  %s\tpermission denied\n", file)
+				files = append(files, ConfigFile{Path: file, Status: StatusPermissionDenied})
 				continue
 			}
 
-			return err
+			return nil, err
 		}
 
 		f.Close()
-		fmt.Fprintf(w, "  %s\tparsed\n", file)
-	}
 
-	w.Flush()
-
-	app.Exit(0)
+		files = append(files, ConfigFile{Path: file, Status: StatusParsed})
+	}
 
-	return nil
+	return files, nil
 }
 
 // Configs returns all configured absolute paths form kong.Vars.
 func Configs(vars kong.Vars) []string {
 	paths := []string{}
+	if vars[configPathsKey] == "" {
+		return paths
+	}
+
 	for f := range strings.SplitSeq(vars[configPathsKey], ",") {
 		paths = append(paths, kong.ExpandPath(f))
 	}
 
 	return paths
 }
-
-func configsForApp(name string) []string {
-	return []string{
-		"./" + name + ".yaml",
-		path.Join("~/.config/", name, "config.yaml"),
-		"/etc/" + name + "/config.yaml",
-	}
-}
@@ -0,0 +1,361 @@
+package king
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+// All supported documentation formats.
+const (
+	Man      = "man"
+	Markdown = "markdown"
+)
+
+// DocsFlag prints the reference documentation of the application as man
+// page (--docs=man) or Markdown (--docs=markdown).
+type DocsFlag string
+
+// Decode implements kong.MapperValue.
+func (d *DocsFlag) Decode(ctx *kong.DecodeContext) error {
+	v, err := popChoice(ctx, "format", Man, Markdown)
+	if err != nil {
+		return err
+	}
+
+	*d = DocsFlag(v)
+
+	return nil
+}
+
+// BeforeApply is the actual docs command.
+func (DocsFlag) BeforeApply(app *kong.Kong, ctx *kong.Context, path *kong.Path) error {
+	format := parsedFlagValue[DocsFlag](ctx, path)
+
+	var err error
+
+	if format == Man {
+		err = WriteManPage(app.Stdout, app.Model)
+	} else {
+		err = WriteMarkdown(app.Stdout, app.Model)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	app.Exit(0)
+
+	return nil
+}
+
+// reference is the documentation of an application.
+type reference struct {
+	name        string
+	description string
+	version     *Version
+	configs     []string
+	env         bool
+	commands    []refCommand
+}
+
+type refCommand struct {
+	name     string
+	synopsis string
+	help     string
+	detail   string
+	flags    []refFlag
+}
+
+type refFlag struct {
+	flag      string
+	help      string
+	def       string
+	envs      []string
+	configKey string
+}
+
+func newReference(app *kong.Application) reference {
+	vars := app.Vars()
+	r := reference{
+		name:        app.Name,
+		description: app.Help,
+		env:         hasLayer(vars, LayerEnv),
+	}
+
+	// The paths are documented unexpanded, as the home directory of the
+	// reader is unknown.
+	if vars[configPathsKey] != "" {
+		r.configs = strings.Split(vars[configPathsKey], ",")
+	}
+
+	if b := newBuildInfo("king_", vars); b != nil {
+		v := b.Version(app.Name)
+		r.version = &v
+	}
+
+	walk(app.Node, func(n *kong.Node) {
+		if n.Hidden || (n.Type != kong.CommandNode && n.Type != kong.ApplicationNode) {
+			return
+		}
+
+		c := refCommand{
+			name:     n.FullPath(),
+			synopsis: strings.TrimSpace(app.Name + " " + strings.TrimSpace(n.Summary())),
+			help:     n.Help,
+			detail:   n.Detail,
+		}
+
+		for _, f := range n.Flags {
+			if f.Hidden {
+				continue
+			}
+
+			c.flags = append(c.flags, newRefFlag(app.Name, n, f, r.env))
+		}
+
+		r.commands = append(r.commands, c)
+	})
+
+	return r
+}
+
+func newRefFlag(appName string, n *kong.Node, f *kong.Flag, env bool) refFlag {
+	r := refFlag{
+		flag: f.String(),
+		help: f.Help,
+		def:  f.Default,
+	}
+
+	if env && !ignoredFlagsNames[f.Name] {
+		r.envs = envVarNames(appName, f.Value)
+	}
+
+	if configurable(f) {
+		r.configKey = strings.Join(append(commandPath(n), f.Name), ".")
+	}
+
+	return r
+}
+
+// WriteMarkdown writes the reference documentation of the application as Markdown.
+//
+// For each flag the environment variables, the key in the configuration
+// file and the default are documented. The environment variables are
+// omitted if LayerEnv is disabled.
+func WriteMarkdown(w io.Writer, app *kong.Application) error {
+	r := newReference(app)
+
+	fmt.Fprintf(w, "# %s\n\n", r.name)
+
+	if r.description != "" {
+		fmt.Fprintf(w, "%s\n\n", r.description)
+	}
+
+	if r.version != nil {
+		fmt.Fprintf(w, "Version %s (revision: %s, build date: %s)\n\n", r.version.Version, r.version.Revision, r.version.Date)
+	}
+
+	for _, c := range r.commands {
+		level := "##"
+		if c.name != r.name {
+			level = "###"
+		}
+
+		fmt.Fprintf(w, "%s %s\n\n", level, c.name)
+
+		if c.name != r.name && c.help != "" {
+			fmt.Fprintf(w, "%s\n\n", c.help)
+		}
+
+		if c.detail != "" {
+			fmt.Fprintf(w, "%s\n\n", c.detail)
+		}
+
+		fmt.Fprintf(w, "```\n%s\n```\n\n", c.synopsis)
+
+		if len(c.flags) == 0 {
+			continue
+		}
+
+		writeMarkdownFlags(w, c.flags, r.env)
+
+		fmt.Fprintln(w)
+	}
+
+	if len(r.configs) > 0 {
+		fmt.Fprintf(w, "## Configuration files\n\n")
+		fmt.Fprintf(w, "The following files are read in this order, values of later files override values of earlier files:\n\n")
+
+		for _, c := range r.configs {
+			fmt.Fprintf(w, "- `%s`\n", c)
+		}
+
+		fmt.Fprintf(w, "\nFlags of commands are looked up in a section named after the command first and then at the top level.\n")
+	}
+
+	return nil
+}
+
+// writeMarkdownFlags writes the table of flags, the environment column is
+// omitted if env is false.
+func writeMarkdownFlags(w io.Writer, flags []refFlag, env bool) {
+	if env {
+		fmt.Fprintln(w, "| Flag | Environment | Config key | Default | Description |")
+		fmt.Fprintln(w, "|------|-------------|------------|---------|-------------|")
+	} else {
+		fmt.Fprintln(w, "| Flag | Config key | Default | Description |")
+		fmt.Fprintln(w, "|------|------------|---------|-------------|")
+	}
+
+	for _, f := range flags {
+		cols := []string{markdownCode(f.flag)}
+		if env {
+			cols = append(cols, markdownCode(f.envs...))
+		}
+
+		cols = append(cols, markdownCode(f.configKey), markdownCode(f.def), markdownEscape(f.help))
+
+		fmt.Fprintf(w, "| %s |\n", strings.Join(cols, " | "))
+	}
+}
+
+func markdownCode(s ...string) string {
+	l := []string{}
+
+	for _, v := range s {
+		if v != "" {
+			l = append(l, "`"+markdownEscape(v)+"`")
+		}
+	}
+
+	return strings.Join(l, ", ")
+}
+
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// WriteManPage writes the reference documentation of the application as man page (roff).
+//
+// For each flag the environment variables, the key in the configuration
+// file and the default are documented. The environment variables are
+// omitted if LayerEnv is disabled.
+func WriteManPage(w io.Writer, app *kong.Application) error {
+	r := newReference(app)
+
+	date := time.Now().Format("2006-01-02")
+	source := r.name
+
+	if r.version != nil {
+		if d, err := time.Parse(time.RFC3339, r.version.Date); err == nil {
+			date = d.Format("2006-01-02")
+		}
+
+		source += " " + r.version.Version
+	}
+
+	fmt.Fprintf(w, ".TH %s 1 %s %s \"User Commands\"\n", roffQuote(strings.ToUpper(r.name)), roffQuote(date), roffQuote(source))
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintf(w, "%s \\- %s\n", roffEscape(r.name), roffEscape(firstLine(r.description)))
+
+	for i, c := range r.commands {
+		if i == 0 {
+			fmt.Fprintln(w, ".SH SYNOPSIS")
+			fmt.Fprintf(w, ".B %s\n", roffEscape(c.synopsis))
+			fmt.Fprintln(w, ".SH DESCRIPTION")
+			fmt.Fprintln(w, roffEscape(r.description))
+
+			if c.detail != "" {
+				fmt.Fprintln(w, ".PP")
+				fmt.Fprintln(w, roffEscape(c.detail))
+			}
+
+			if len(c.flags) > 0 {
+				fmt.Fprintln(w, ".SH OPTIONS")
+				writeManFlags(w, c.flags)
+			}
+
+			if len(r.commands) > 1 {
+				fmt.Fprintln(w, ".SH COMMANDS")
+			}
+
+			continue
+		}
+
+		fmt.Fprintf(w, ".SS %s\n", roffQuote(c.name))
+		fmt.Fprintf(w, ".B %s\n", roffEscape(c.synopsis))
+		fmt.Fprintln(w, ".PP")
+		fmt.Fprintln(w, roffEscape(c.help))
+
+		if c.detail != "" {
+			fmt.Fprintln(w, ".PP")
+			fmt.Fprintln(w, roffEscape(c.detail))
+		}
+
+		writeManFlags(w, c.flags)
+	}
+
+	if len(r.configs) > 0 {
+		fmt.Fprintln(w, ".SH FILES")
+		fmt.Fprintln(w, "The following files are read in this order, values of later files override values of earlier files.")
+		fmt.Fprintln(w, "Flags of commands are looked up in a section named after the command first and then at the top level.")
+
+		for _, c := range r.configs {
+			fmt.Fprintln(w, ".TP")
+			fmt.Fprintf(w, ".I %s\n", roffEscape(c))
+		}
+	}
+
+	if r.version != nil {
+		fmt.Fprintln(w, ".SH VERSION")
+		fmt.Fprintf(w, "%s (revision: %s, build date: %s, go version: %s)\n",
+			roffEscape(r.version.Version), roffEscape(r.version.Revision), roffEscape(r.version.Date), roffEscape(r.version.GoVersion))
+	}
+
+	return nil
+}
+
+func writeManFlags(w io.Writer, flags []refFlag) {
+	for _, f := range flags {
+		fmt.Fprintln(w, ".TP")
+		fmt.Fprintf(w, "\\fB%s\\fR\n", roffEscape(f.flag))
+		fmt.Fprintln(w, roffEscape(f.help))
+
+		if f.def != "" {
+			fmt.Fprintln(w, ".br")
+			fmt.Fprintf(w, "Default: %s\n", roffEscape(f.def))
+		}
+
+		if len(f.envs) > 0 {
+			fmt.Fprintln(w, ".br")
+			fmt.Fprintf(w, "Environment: %s\n", roffEscape(strings.Join(f.envs, ", ")))
+		}
+
+		if f.configKey != "" {
+			fmt.Fprintln(w, ".br")
+			fmt.Fprintf(w, "Config key: %s\n", roffEscape(f.configKey))
+		}
+	}
+}
+
+// roffEscape escapes s for the use in a roff document.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, ".") || strings.HasPrefix(l, "'") {
+			lines[i] = `\&` + l
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func roffQuote(s string) string {
+	return `"` + strings.ReplaceAll(roffEscape(s), `"`, `\(dq`) + `"`
+}
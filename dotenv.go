@@ -0,0 +1,172 @@
+package king
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+var dotEnvKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// dotEnvResolver reads a .env file. The variables are mapped to flags by
+// the same names EnvResolver uses.
+func dotEnvResolver(r io.Reader) (kong.Resolver, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := parseDotEnv(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var f kong.ResolverFunc = func(ctx *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
+		if ignoredFlagsNames[flag.Name] {
+			return nil, nil
+		}
+
+		for _, name := range envVarNames(ctx.Model.Name, flag.Value) {
+			if v, ok := values[name]; ok {
+				return v, nil
+			}
+		}
+
+		return nil, nil
+	}
+
+	return f, nil
+}
+
+// parseDotEnv parses the content of a .env file.
+//
+// Lines have the form KEY=VALUE and can be prefixed with "export". Empty
+// lines and lines starting with # are ignored. Values are either unquoted,
+// single quoted or double quoted:
+//
+//	KEY=value # comment    unquoted values end at a # preceded by white space
+//	KEY='$literal'         single quoted values are used as is
+//	KEY="line1\nline2"     double quoted values support Go escape sequences and \$
+//
+// Quoted values can span multiple lines.
+func parseDotEnv(data string) (map[string]string, error) {
+	values := map[string]string{}
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	line := 0
+
+	for data != "" {
+		line++
+
+		l, rest, found := strings.Cut(data, "\n")
+		data = rest
+
+		l = strings.TrimLeft(l, " \t")
+		if strings.TrimSpace(l) == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		if after, ok := strings.CutPrefix(l, "export"); ok && after != "" && (after[0] == ' ' || after[0] == '\t') {
+			l = strings.TrimLeft(after, " \t")
+		}
+
+		key, value, ok := strings.Cut(l, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", line)
+		}
+
+		key = strings.TrimSpace(key)
+		if !dotEnvKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid key %q", line, key)
+		}
+
+		value = strings.TrimLeft(value, " \t")
+
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			if i := inlineComment(value); i >= 0 {
+				value = value[:i]
+			}
+
+			values[key] = strings.TrimSpace(value)
+
+			continue
+		}
+
+		// Quoted values can continue on the following lines.
+		if found {
+			value += "\n" + data
+		}
+
+		v, tail, err := unquoteDotEnv(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", line, key, err)
+		}
+
+		consumed := len(value) - len(tail)
+		line += strings.Count(value[:consumed], "\n")
+
+		l, data, _ = strings.Cut(tail, "\n")
+		if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, "#") {
+			return nil, fmt.Errorf("line %d: %s: unexpected %q after quoted value", line, key, l)
+		}
+
+		values[key] = v
+	}
+
+	return values, nil
+}
+
+// inlineComment returns the index of a comment in an unquoted value or -1.
+func inlineComment(value string) int {
+	for i := 1; i < len(value); i++ {
+		if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// unquoteDotEnv unquotes the quoted value at the start of s and returns it
+// together with the rest of s.
+func unquoteDotEnv(s string) (value, rest string, err error) {
+	quote := s[0]
+	s = s[1:]
+
+	if quote == '\'' {
+		i := strings.IndexByte(s, '\'')
+		if i < 0 {
+			return "", "", errors.New("missing closing quote")
+		}
+
+		return s[:i], s[i+1:], nil
+	}
+
+	var b strings.Builder
+
+	for {
+		switch {
+		case s == "":
+			return "", "", errors.New("missing closing quote")
+		case s[0] == '"':
+			return b.String(), s[1:], nil
+		case strings.HasPrefix(s, `\$`):
+			b.WriteByte('$')
+
+			s = s[2:]
+		default:
+			r, _, tail, err := strconv.UnquoteChar(s, '"')
+			if err != nil {
+				return "", "", fmt.Errorf("invalid escape sequence in %q", firstLine(s))
+			}
+
+			b.WriteRune(r)
+
+			s = tail
+		}
+	}
+}
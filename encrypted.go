@@ -0,0 +1,185 @@
+package king
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+)
+
+const (
+	encPrefix = "ENC[age,"
+	encSuffix = "]"
+)
+
+// Encrypt encrypts value for the age recipients (public keys) and returns
+// it as ENC[age,...] envelope that can be used as value in configuration
+// files.
+func Encrypt(value string, recipients ...string) (string, error) {
+	if len(recipients) == 0 {
+		return "", errors.New("no recipients")
+	}
+
+	rs := make([]age.Recipient, 0, len(recipients))
+
+	for _, r := range recipients {
+		recipient, err := age.ParseX25519Recipient(r)
+		if err != nil {
+			return "", err
+		}
+
+		rs = append(rs, recipient)
+	}
+
+	buf := &bytes.Buffer{}
+
+	w, err := age.Encrypt(buf, rs...)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.WriteString(w, value); err != nil {
+		return "", err
+	}
+
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	return encPrefix + base64.StdEncoding.EncodeToString(buf.Bytes()) + encSuffix, nil
+}
+
+// EncryptCmd is a command that encrypts a value for the use in a
+// configuration file. The value is read from stdin, arguments would be
+// visible in the process list and the shell history:
+//
+//	printf %s "$PASSWORD" | app encrypt -r age1...
+//
+//	Usage:
+//	type CLI struct {
+//	    Encrypt king.EncryptCmd `cmd:"" help:"Encrypt a configuration value read from stdin."`
+//	}
+type EncryptCmd struct {
+	Recipient []string `short:"r" help:"Age recipient (public key), repeatable." required:""`
+}
+
+// Run encrypts the value read from stdin.
+func (e EncryptCmd) Run(ctx *kong.Context) error {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	s, err := Encrypt(strings.TrimRight(string(data), "\r\n"), e.Recipient...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(ctx.Stdout, s)
+
+	return nil
+}
+
+// ageIdentities loads the age identities from a file when they are first
+// needed.
+type ageIdentities struct {
+	path   string
+	envVar string
+
+	once       sync.Once
+	identities []age.Identity
+	err        error
+}
+
+func (a *ageIdentities) load() ([]age.Identity, error) {
+	a.once.Do(func() {
+		if a.path == "" {
+			a.err = fmt.Errorf("no age identity file configured (set $%s)", a.envVar)
+			return
+		}
+
+		f, err := os.Open(filepath.Clean(kong.ExpandPath(a.path)))
+		if err != nil {
+			a.err = err
+			return
+		}
+
+		defer f.Close()
+
+		a.identities, a.err = age.ParseIdentities(f)
+		if a.err != nil {
+			a.err = fmt.Errorf("%s: %w", a.path, a.err)
+		}
+	})
+
+	return a.identities, a.err
+}
+
+// decryptingResolver decrypts ENC[age,...] values of a configuration file
+// and marks the flags as sensitive.
+type decryptingResolver struct {
+	kong.Resolver
+	path       string
+	identities *ageIdentities
+	tracker    *tracker
+}
+
+func (r decryptingResolver) Resolve(ctx *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
+	v, err := r.Resolver.Resolve(ctx, parent, flag)
+	if err != nil || v == nil {
+		return v, err
+	}
+
+	sensitive := false
+
+	v, err = mapStrings(v, func(s string) (string, error) {
+		if !strings.HasPrefix(s, encPrefix) || !strings.HasSuffix(s, encSuffix) {
+			return s, nil
+		}
+
+		sensitive = true
+
+		return r.decrypt(strings.TrimSuffix(strings.TrimPrefix(s, encPrefix), encSuffix))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", r.path, flag.Name, err)
+	}
+
+	if sensitive {
+		r.tracker.markSensitive(ctx, flag.Name)
+	}
+
+	return v, nil
+}
+
+func (r decryptingResolver) decrypt(s string) (string, error) {
+	identities, err := r.identities.load()
+	if err != nil {
+		return "", fmt.Errorf("age: %w", err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("age: %w", err)
+	}
+
+	d, err := age.Decrypt(bytes.NewReader(data), identities...)
+	if err != nil {
+		return "", fmt.Errorf("age: %w", err)
+	}
+
+	plain, err := io.ReadAll(d)
+	if err != nil {
+		return "", fmt.Errorf("age: %w", err)
+	}
+
+	return string(plain), nil
+}
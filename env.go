@@ -1,8 +1,13 @@
 package king
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/alecthomas/kong"
 )
@@ -16,6 +21,8 @@ var ignoredFlagsNames = map[string]bool{
 //
 // Hyphens in flag names are replaced with underscores.
 // Flag names are prefixed with app name and converted to uppercase.
+// The variables of the env tag of a flag are read as well, so they have the
+// precedence of the environment and not of a default.
 //
 //	Usage:
 //	ctx := kong.Parse(&cli,
@@ -27,20 +34,210 @@ func EnvResolver() kong.Resolver {
 		if ok := ignoredFlagsNames[flag.Name]; ok {
 			return nil, nil
 		}
-		raw, ok := os.LookupEnv(toEnvVarName(context.Model.Name, flag.Value))
-		if !ok {
-			return nil, nil
+		for _, name := range envVarNames(context.Model.Name, flag.Value) {
+			if raw, ok := os.LookupEnv(name); ok {
+				return raw, nil
+			}
 		}
-		return raw, nil
+
+		return nil, nil
 	}
 
 	return f
 }
 
 func toEnvVarName(prefix string, value *kong.Value) string {
+	return envVarName(prefix, value.Name)
+}
+
+func envVarName(prefix, name string) string {
 	if prefix != "" {
 		prefix += "_"
 	}
 
-	return strings.ToUpper(strings.ReplaceAll(prefix+value.Name, "-", "_"))
+	return strings.ToUpper(strings.ReplaceAll(prefix+name, "-", "_"))
+}
+
+// EnvHelpFlag displays all environment variables the application reads.
+//
+// With --env-help a table is shown, with --env-help=dotenv the variables
+// are printed in the format of a .env.example file.
+type EnvHelpFlag string
+
+// All EnvHelpFlag formats.
+const (
+	EnvHelpTable  = "table"
+	EnvHelpDotEnv = "dotenv"
+)
+
+// Decode implements kong.MapperValue.
+func (e *EnvHelpFlag) Decode(ctx *kong.DecodeContext) error {
+	*e = EnvHelpTable
+
+	if ctx.Scan.Peek().Type != kong.FlagValueToken {
+		return nil
+	}
+
+	switch v := ctx.Scan.Pop().String(); v {
+	case EnvHelpTable, EnvHelpDotEnv:
+		*e = EnvHelpFlag(v)
+	default:
+		return fmt.Errorf("format must be %s or %s but got %q", EnvHelpTable, EnvHelpDotEnv, v)
+	}
+
+	return nil
+}
+
+// IsBool implements kong.BoolMapperValue.
+func (e *EnvHelpFlag) IsBool() bool {
+	return true
+}
+
+// BeforeApply is the actual env-help command.
+//
+// The table is empty if LayerEnv is disabled and the .env.example is empty
+// if LayerDotEnv is disabled.
+func (EnvHelpFlag) BeforeApply(app *kong.Kong, ctx *kong.Context, path *kong.Path) error {
+	vars := EnvVars(app)
+
+	if parsedFlagValue[EnvHelpFlag](ctx, path) == EnvHelpDotEnv {
+		if !hasLayer(app.Model.Vars(), LayerDotEnv) {
+			vars = nil
+		}
+
+		WriteDotEnv(app.Stdout, vars)
+	} else {
+		if !hasLayer(app.Model.Vars(), LayerEnv) {
+			vars = nil
+		}
+
+		writeEnvTable(app.Stdout, vars)
+	}
+
+	app.Exit(0)
+
+	return nil
+}
+
+// EnvVar is an environment variable read by the application.
+type EnvVar struct {
+	Name      string `json:"name" yaml:"name"`
+	Flag      string `json:"flag" yaml:"flag"`
+	Type      string `json:"type" yaml:"type"`
+	Default   string `json:"default,omitempty" yaml:"default,omitempty"`
+	Help      string `json:"help,omitempty" yaml:"help,omitempty"`
+	Value     string `json:"value,omitempty" yaml:"value,omitempty"`
+	Set       bool   `json:"set" yaml:"set"`
+	Sensitive bool   `json:"sensitive" yaml:"sensitive"`
+}
+
+// EnvVars returns all environment variables the application reads, sorted by name.
+//
+// Values of flags with a `sensitive:""` tag are redacted.
+func EnvVars(app *kong.Kong) []EnvVar {
+	return envVars(app.Model)
+}
+
+func envVars(app *kong.Application) []EnvVar {
+	vars := []EnvVar{}
+	seen := map[string]bool{}
+
+	for _, f := range modelFlags(app.Node) {
+		if ignoredFlagsNames[f.Name] {
+			continue
+		}
+
+		for _, name := range envVarNames(app.Name, f.Value) {
+			if seen[name] {
+				continue
+			}
+
+			seen[name] = true
+
+			v := EnvVar{
+				Name:      name,
+				Flag:      f.Name,
+				Type:      typeName(f.Value),
+				Default:   f.Default,
+				Help:      f.Help,
+				Sensitive: isSensitive(f.Value),
+			}
+
+			v.Value, v.Set = os.LookupEnv(name)
+			if v.Set && v.Sensitive {
+				v.Value = strings.Repeat(redactChar, len(v.Value))
+			}
+
+			vars = append(vars, v)
+		}
+	}
+
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+
+	return vars
+}
+
+// WriteDotEnv writes environment variables in the format of a .env.example file.
+//
+// Variables without a default and of flags with a `sensitive:""` tag are
+// commented out, so the file can be used as .env file as it is.
+func WriteDotEnv(w io.Writer, vars []EnvVar) {
+	for i, v := range vars {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		if v.Help != "" {
+			fmt.Fprintf(w, "# %s\n", v.Help)
+		}
+
+		fmt.Fprintf(w, "# flag: --%s, type: %s\n", v.Flag, v.Type)
+
+		if v.Default == "" || v.Sensitive {
+			fmt.Fprintf(w, "# %s=\n", v.Name)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s=%s\n", v.Name, quoteDotEnv(v.Default))
+	}
+}
+
+func writeEnvTable(out io.Writer, vars []EnvVar) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "VARIABLE\tFLAG\tTYPE\tDEFAULT\tSET\tHELP")
+
+	for _, v := range vars {
+		set := "-"
+		if v.Set {
+			set = strconv.Quote(v.Value)
+		}
+
+		fmt.Fprintf(w, "%s\t--%s\t%s\t%s\t%s\t%s\n", v.Name, v.Flag, v.Type, v.Default, set, v.Help)
+	}
+
+	w.Flush()
+}
+
+func quoteDotEnv(s string) string {
+	if strings.ContainsAny(s, " \t\"'#$\\\n") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// envVarNames returns all environment variables that are read for a flag.
+func envVarNames(prefix string, value *kong.Value) []string {
+	names := []string{toEnvVarName(prefix, value)}
+
+	for _, env := range value.Tag.Envs {
+		if !contains(names, env) {
+			names = append(names, env)
+		}
+	}
+
+	return names
 }
@@ -1,72 +1,316 @@
 package king
 
 import (
+	"errors"
+	"fmt"
 	"io"
-	"io/ioutil"
+	"slices"
+	"strings"
+	"unicode"
 
 	"github.com/BurntSushi/toml"
 	"github.com/alecthomas/kong"
 	"gopkg.in/yaml.v3"
 )
 
+const configTag = "config"
+
 // FileResolver represents a kong fileresolver.
 type FileResolver string
 
 // All supported file resolvers.
 const (
-	YAML FileResolver = "yaml"
-	TOML FileResolver = "toml"
+	YAML       FileResolver = "yaml"
+	TOML       FileResolver = "toml"
+	INI        FileResolver = "ini"
+	Properties FileResolver = "properties"
+	DotEnv     FileResolver = "dotenv"
 )
 
+func (f FileResolver) extension() string {
+	switch f {
+	case "":
+		return string(YAML)
+	case DotEnv:
+		return "env"
+	default:
+		return string(f)
+	}
+}
+
 // NewFileResolver creates a new fileresolver.
+//
+// Flags of commands are looked up in a section named after the command
+// first and then at the top level. The flag "listen" of the command
+// "server start" is looked up as "server.start.listen", "server.listen" and
+// "listen". Flags of prefix groups can be nested in a section named after
+// the prefix, "db-host" is looked up as "db.host" too. Keys are
+// normalised, "listen-address" matches "listen_address" and "listenAddress"
+// as well. Renamed keys can be listed in a `config:"old-name"` tag. It is
+// an error if a section contains more than one key for the same flag.
+//
+// INI sections and dotted keys of properties files are sections as well.
+// The DotEnv resolver reads .env files, the variables have the same names
+// EnvResolver reads.
 func NewFileResolver(f FileResolver) kong.ConfigurationLoader {
+	if f == DotEnv {
+		return dotEnvResolver
+	}
+
+	decode := f.decoder()
+
+	return func(r io.Reader) (kong.Resolver, error) {
+		values, err := decode(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return mapResolver(values), nil
+	}
+}
+
+// decoder returns the function that decodes files of f into nested maps.
+func (f FileResolver) decoder() func(io.Reader) (map[string]any, error) {
 	switch f {
 	case TOML:
-		return tomlResolver
+		return decodeTOML
+	case INI:
+		return decodeINI
+	case Properties:
+		return decodeProperties
 	default:
-		return yamlResolver
+		return decodeYAML
 	}
 }
 
-func yamlResolver(r io.Reader) (kong.Resolver, error) {
+func decodeYAML(r io.Reader) (map[string]any, error) {
 	values := map[string]any{}
 
 	err := yaml.NewDecoder(r).Decode(&values)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func decodeTOML(r io.Reader) (map[string]any, error) {
+	values := map[string]any{}
+
+	data, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := toml.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func mapResolver(values map[string]any) kong.Resolver {
 	var f kong.ResolverFunc = func(ctx *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
-		raw, ok := values[flag.Name]
-		if !ok {
-			return nil, nil
+		raw, ok, err := lookup(values, sections(parent), keyNames(flag))
+		if err != nil || !ok {
+			return nil, err
+		}
+
+		// kong panics if a counter is set with a number of a different type.
+		if flag.IsCounter() {
+			if _, ok := raw.(string); !ok {
+				return fmt.Sprint(raw), nil
+			}
 		}
 
 		return raw, nil
 	}
 
-	return f, nil
+	return f
 }
 
-func tomlResolver(r io.Reader) (kong.Resolver, error) {
-	values := map[string]any{}
+// keyNames returns the normalised name of flag and the aliases of its
+// `config:""` tag.
+func keyNames(flag *kong.Flag) []string {
+	names := []string{flag.Name}
 
-	data, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, err
+	for alias := range strings.SplitSeq(flag.Tag.Get(configTag), ",") {
+		if alias = normalizeKey(strings.TrimSpace(alias)); alias != "" && !slices.Contains(names, alias) {
+			names = append(names, alias)
+		}
 	}
 
-	if err := toml.Unmarshal(data, &values); err != nil {
-		return nil, err
+	return names
+}
+
+// lookup looks up the keys names in the most specific section first. It is
+// an error if a section contains more than one of them.
+func lookup(values map[string]any, sections []string, names []string) (any, bool, error) {
+	for i := len(sections); i >= 0; i-- {
+		section, ok, err := subsection(values, sections[:i])
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		var (
+			raw   any
+			found []string
+		)
+
+		for _, name := range names {
+			v, key, ok, err := lookupKey(section, name)
+			if err != nil {
+				return nil, false, err
+			}
+
+			if ok {
+				raw, found = v, append(found, key)
+			}
+		}
+
+		if len(found) > 1 {
+			return nil, false, ambiguous(found)
+		}
+
+		if len(found) == 1 {
+			return raw, true, nil
+		}
 	}
 
-	var f kong.ResolverFunc = func(ctx *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
-		raw, ok := values[flag.Name]
+	return nil, false, nil
+}
+
+// lookupKey looks up key in section and returns the value and the key it
+// was found as. If key is not found, it is split at dashes and looked up
+// in nested sections, "db-host" as "db.host". The value of a section that
+// has one (see sectionValueKey) is the value of its key.
+func lookupKey(section map[string]any, key string) (any, string, bool, error) {
+	if raw, k, ok, err := findKey(section, key); ok || err != nil {
+		if sub, isSection := raw.(map[string]any); isSection {
+			if v, ok := sub[sectionValueKey]; ok {
+				return v, k, true, nil
+			}
+		}
+
+		return raw, k, ok, err
+	}
+
+	for i := range len(key) {
+		if key[i] != '-' {
+			continue
+		}
+
+		v, k, ok, err := findKey(section, key[:i])
+		if err != nil {
+			return nil, "", false, err
+		}
+
+		if sub, isSection := v.(map[string]any); ok && isSection {
+			raw, subKey, ok, err := lookupKey(sub, key[i+1:])
+			if ok || err != nil {
+				return raw, k + "." + subKey, ok, err
+			}
+		}
+	}
+
+	return nil, "", false, nil
+}
+
+// findKey returns the value of the key of section that is equal to key once
+// normalised. Keys in kebab, snake and camel case are equal, it is an error
+// if section contains more than one of them.
+func findKey(section map[string]any, key string) (any, string, bool, error) {
+	var (
+		raw   any
+		found []string
+	)
+
+	for k, v := range section {
+		if k == key || normalizeKey(k) == key {
+			raw, found = v, append(found, k)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, "", false, nil
+	case 1:
+		return raw, found[0], true, nil
+	default:
+		return nil, "", false, ambiguous(found)
+	}
+}
+
+func ambiguous(keys []string) error {
+	slices.Sort(keys)
+
+	return fmt.Errorf("ambiguous keys %s", strings.Join(keys, ", "))
+}
+
+// normalizeKey converts a key in snake or camel case to kebab case,
+// "listen_address" and "listenAddress" to "listen-address".
+func normalizeKey(key string) string {
+	var b strings.Builder
+
+	runes := []rune(key)
+
+	for i, r := range runes {
+		switch {
+		case r == '_':
+			b.WriteRune('-')
+		case unicode.IsUpper(r):
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteRune('-')
+			}
+
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func subsection(values map[string]any, sections []string) (map[string]any, bool, error) {
+	for _, s := range sections {
+		v, _, ok, err := findKey(values, s)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+
+		values, ok = v.(map[string]any)
 		if !ok {
-			return nil, nil
+			return nil, false, nil
+		}
+	}
+
+	return values, true, nil
+}
+
+// sections returns the names of the commands leading to the node of parent.
+func sections(parent *kong.Path) []string {
+	if parent == nil {
+		return nil
+	}
+
+	return commandPath(parent.Node())
+}
+
+// commandPath returns the names of the commands leading to node.
+func commandPath(node *kong.Node) []string {
+	path := []string{}
+
+	for n := node; n != nil; n = n.Parent {
+		if n.Type == kong.CommandNode {
+			path = append([]string{n.Name}, path...)
 		}
-		return raw, nil
 	}
 
-	return f, nil
+	return path
 }
@@ -0,0 +1,79 @@
+package king
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	contentTypeJSON = "application/json"
+	contentTypeYAML = "application/yaml"
+)
+
+// VersionHandler returns a http.Handler that serves the version as JSON.
+//
+//	Usage:
+//	mux.Handle("/version", king.VersionHandler(b.Version(appName)))
+func VersionHandler(v Version) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		write(w, contentTypeJSON, v)
+	})
+}
+
+// ConfigHandler returns a http.Handler that serves the effective settings
+// (see EffectiveSettings) of *kong.Context.
+//
+// The settings are served as JSON unless YAML is requested with the query
+// parameter "format=yaml" or an Accept header containing "yaml".
+//
+//	Usage:
+//	mux.Handle("/debug/config", king.ConfigHandler(app, regexp.MustCompile("token")))
+func ConfigHandler(ctx *kong.Context, redactFlags ...*regexp.Regexp) http.Handler {
+	s := EffectiveSettings(ctx, redactFlags...)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		write(w, negotiate(r), s)
+	})
+}
+
+func negotiate(r *http.Request) string {
+	if f := r.URL.Query().Get("format"); f != "" {
+		if f == "yaml" {
+			return contentTypeYAML
+		}
+
+		return contentTypeJSON
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "yaml") {
+		return contentTypeYAML
+	}
+
+	return contentTypeJSON
+}
+
+func write(w http.ResponseWriter, contentType string, v any) {
+	var (
+		data []byte
+		err  error
+	)
+
+	if contentType == contentTypeYAML {
+		data, err = yaml.Marshal(v)
+	} else {
+		data, err = json.MarshalIndent(v, "", "  ")
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(data)
+}
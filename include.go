@@ -0,0 +1,136 @@
+package king
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+const (
+	includesKey = "king_includes"
+
+	// maxIncludeDepth is the maximum length of a chain of included files.
+	maxIncludeDepth = 10
+)
+
+// includeKeys are the keys of the include directive, they are equivalent.
+var includeKeys = []string{"extends", "include"}
+
+// resolveIncludes merges the files included by the extends or include key
+// of a configuration file below its own keys if Config.Includes is set. chain
+// is the list of files that included values, the last one is the file of
+// values. Relative paths are resolved relative to the including file,
+// directories and glob patterns are expanded as in Config.ConfigPaths.
+func resolveIncludes(values map[string]any, chain []string, f FileResolver) (map[string]any, error) {
+	includes := []string{}
+
+	for _, key := range includeKeys {
+		v, ok := values[key]
+		if !ok {
+			continue
+		}
+
+		delete(values, key)
+
+		l, err := includePaths(v)
+		if err != nil {
+			return nil, fmt.Errorf("include chain %s: %s: %w", strings.Join(chain, " -> "), key, err)
+		}
+
+		includes = append(includes, l...)
+	}
+
+	if len(includes) == 0 {
+		return values, nil
+	}
+
+	dir := "."
+	if current := chain[len(chain)-1]; current != stdinPath {
+		dir = filepath.Dir(current)
+	}
+
+	merged := map[string]any{}
+
+	for _, include := range includes {
+		if !filepath.IsAbs(include) && !strings.HasPrefix(include, "~") {
+			include = filepath.Join(dir, include)
+		}
+
+		include = kong.ExpandPath(include)
+
+		files, err := fragments(include, f.extension())
+		if err != nil {
+			return nil, fmt.Errorf("include chain %s: %w", strings.Join(chain, " -> "), err)
+		}
+
+		for _, file := range files {
+			included, err := includeFile(file, chain, f)
+			if err != nil {
+				return nil, err
+			}
+
+			merge(merged, included)
+		}
+	}
+
+	merge(merged, values)
+
+	return merged, nil
+}
+
+// includeFile decodes the included file and resolves its includes.
+func includeFile(file string, chain []string, f FileResolver) (map[string]any, error) {
+	file = filepath.Clean(file)
+	chain = append(chain[:len(chain):len(chain)], file)
+	desc := strings.Join(chain, " -> ")
+
+	if slices.ContainsFunc(chain[:len(chain)-1], func(p string) bool { return filepath.Clean(p) == file }) {
+		return nil, fmt.Errorf("include cycle %s", desc)
+	}
+
+	if len(chain) > maxIncludeDepth {
+		return nil, fmt.Errorf("include chain %s: more than %d levels", desc, maxIncludeDepth)
+	}
+
+	r, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, fmt.Errorf("include chain %s: %w", desc, err)
+	}
+
+	defer r.Close()
+
+	values, err := f.decoder()(r)
+	if err != nil {
+		return nil, fmt.Errorf("include chain %s: %w", desc, err)
+	}
+
+	return resolveIncludes(values, chain, f)
+}
+
+// includePaths returns the paths of an include directive, a string or a
+// list of strings.
+func includePaths(v any) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case []any:
+		paths := []string{}
+
+		for _, p := range v {
+			s, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a path, got %v", p)
+			}
+
+			paths = append(paths, s)
+		}
+
+		return paths, nil
+	default:
+		return nil, fmt.Errorf("expected a path or a list of paths, got %v", v)
+	}
+}
@@ -0,0 +1,295 @@
+package king
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// decodeINI reads INI files. Keys before the first section are top
+// level keys, a dotted section [server.start] is nested like a TOML table.
+// Lines starting with ; or # are comments, values can be quoted.
+func decodeINI(r io.Reader) (map[string]any, error) {
+	values := map[string]any{}
+	section := []string{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		l := strings.TrimSpace(scanner.Text())
+		if l == "" || l[0] == ';' || l[0] == '#' {
+			continue
+		}
+
+		if l[0] == '[' {
+			name, ok := strings.CutSuffix(l, "]")
+			if !ok {
+				return nil, fmt.Errorf("line %d: missing ] in section header", line)
+			}
+
+			section = strings.Split(strings.TrimSpace(name[1:]), ".")
+			for i := range section {
+				section[i] = strings.TrimSpace(section[i])
+			}
+
+			if _, err := subsectionFor(values, section); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+
+			continue
+		}
+
+		i := strings.IndexAny(l, "=:")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", line)
+		}
+
+		key := strings.TrimSpace(l[:i])
+		if key == "" {
+			return nil, fmt.Errorf("line %d: empty key", line)
+		}
+
+		value, err := iniValue(strings.TrimSpace(l[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", line, key, err)
+		}
+
+		if err := setValue(values, append(section[:len(section):len(section)], key), value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// iniValue unquotes a quoted value or removes an inline comment from an
+// unquoted value.
+func iniValue(s string) (string, error) {
+	if s == "" {
+		return s, nil
+	}
+
+	if s[0] == '"' || s[0] == '\'' {
+		end := closingQuote(s)
+		if end < 0 {
+			return "", errors.New("missing closing quote")
+		}
+
+		if tail := strings.TrimSpace(s[end+1:]); tail != "" && tail[0] != ';' && tail[0] != '#' {
+			return "", fmt.Errorf("unexpected %q after quoted value", tail)
+		}
+
+		if s[0] == '\'' {
+			return s[1:end], nil
+		}
+
+		return strconv.Unquote(s[:end+1])
+	}
+
+	for i := 1; i < len(s); i++ {
+		if (s[i] == ';' || s[i] == '#') && (s[i-1] == ' ' || s[i-1] == '\t') {
+			return strings.TrimSpace(s[:i]), nil
+		}
+	}
+
+	return s, nil
+}
+
+// closingQuote returns the index of the quote that closes the quoted
+// string at the start of s or -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && s[0] == '"':
+			i++
+		case s[i] == s[0]:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// decodeProperties reads Java .properties files. Dotted keys are nested,
+// server.listen is the key listen in the section server. A key can have a
+// value and nested keys, listen=y and listen.address=x.
+func decodeProperties(r io.Reader) (map[string]any, error) {
+	values := map[string]any{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		start := line
+
+		l := strings.TrimLeft(scanner.Text(), " \t\f")
+		if l == "" || l[0] == '#' || l[0] == '!' {
+			continue
+		}
+
+		// An odd number of trailing backslashes continues the line.
+		for continues(l) && scanner.Scan() {
+			line++
+			l = l[:len(l)-1] + strings.TrimLeft(scanner.Text(), " \t\f")
+		}
+
+		key, value, err := propertiesPair(l)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", start, err)
+		}
+
+		if err := setValue(values, strings.Split(key, "."), value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", start, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func continues(l string) bool {
+	n := len(l) - len(strings.TrimRight(l, `\`))
+
+	return n%2 == 1
+}
+
+// propertiesPair splits a logical line into key and value. The key ends at
+// the first unescaped =, : or white space.
+func propertiesPair(l string) (key, value string, err error) {
+	end := len(l)
+
+	for i := 0; i < len(l); i++ {
+		if l[i] == '\\' {
+			i++
+			continue
+		}
+
+		if strings.IndexByte("=: \t\f", l[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+
+	rest := strings.TrimLeft(l[end:], " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+
+	if key, err = unescapeProperties(l[:end]); err != nil {
+		return "", "", err
+	}
+
+	if value, err = unescapeProperties(rest); err != nil {
+		return "", "", fmt.Errorf("%s: %w", key, err)
+	}
+
+	return key, value, nil
+}
+
+func unescapeProperties(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("invalid unicode escape in %q", s)
+			}
+
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return "", fmt.Errorf("invalid unicode escape in %q", s)
+			}
+
+			b.WriteRune(rune(r))
+
+			i += 4
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String(), nil
+}
+
+// sectionValueKey is the key of the value of a section, it holds listen=y
+// next to listen.address=x.
+const sectionValueKey = ""
+
+// setValue sets the value of the nested key path in values. If the key is a
+// section, the value is stored in it under sectionValueKey.
+func setValue(values map[string]any, path []string, value string) error {
+	section, err := subsectionFor(values, path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+
+	key := path[len(path)-1]
+	if sub, ok := section[key].(map[string]any); ok {
+		sub[sectionValueKey] = value
+
+		return nil
+	}
+
+	section[key] = value
+
+	return nil
+}
+
+// subsectionFor returns the nested section path of values, missing
+// sections are created. A value is moved into the new section under
+// sectionValueKey.
+func subsectionFor(values map[string]any, path []string) (map[string]any, error) {
+	for _, s := range path {
+		if s == "" {
+			return nil, fmt.Errorf("empty section name in %q", strings.Join(path, "."))
+		}
+
+		switch v := values[s].(type) {
+		case map[string]any:
+			values = v
+		case nil:
+			m := map[string]any{}
+			values[s] = m
+			values = m
+		default:
+			m := map[string]any{sectionValueKey: v}
+			values[s] = m
+			values = m
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,183 @@
+package king
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// interpolatingResolver expands environment variables in the string values
+// of a configuration file (see interpolate).
+type interpolatingResolver struct {
+	kong.Resolver
+	path string
+}
+
+func (r interpolatingResolver) Resolve(ctx *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
+	v, err := r.Resolver.Resolve(ctx, parent, flag)
+	if err != nil || v == nil {
+		return v, err
+	}
+
+	v, err = mapStrings(v, func(s string) (string, error) {
+		return interpolate(s, os.LookupEnv)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", r.path, flag.Name, err)
+	}
+
+	return v, nil
+}
+
+// mapStrings applies fn to v if v is a string or to all strings in v if v
+// is a list or a map.
+func mapStrings(v any, fn func(string) (string, error)) (any, error) {
+	switch v := v.(type) {
+	case string:
+		return fn(v)
+	case []any:
+		l := make([]any, 0, len(v))
+
+		for _, e := range v {
+			e, err := mapStrings(e, fn)
+			if err != nil {
+				return nil, err
+			}
+
+			l = append(l, e)
+		}
+
+		return l, nil
+	case map[string]any:
+		m := make(map[string]any, len(v))
+
+		for k, e := range v {
+			e, err := mapStrings(e, fn)
+			if err != nil {
+				return nil, err
+			}
+
+			m[k] = e
+		}
+
+		return m, nil
+	default:
+		return v, nil
+	}
+}
+
+// interpolate expands the variables in s with lookup:
+//
+//	${VAR}           value of VAR, empty if VAR is not set
+//	${VAR:-default}  value of VAR, default if VAR is not set or empty
+//	${VAR:?message}  value of VAR, an error with message if VAR is not set or empty
+//	$$               a literal $
+//
+// Defaults and messages are expanded as well. A $ that is not followed by {
+// or $ is kept as is.
+func interpolate(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable in %q", s)
+			}
+
+			v, err := expand(s[i+2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+
+			b.WriteString(v)
+
+			i = end
+		default:
+			b.WriteByte('$')
+		}
+	}
+
+	return b.String(), nil
+}
+
+// closingBrace returns the index of the brace that closes the variable
+// starting at start or -1.
+func closingBrace(s string, start int) int {
+	depth := 1
+
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '$':
+			i++
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// expand expands the expression expr of a variable ${expr}.
+func expand(expr string, lookup func(string) (string, bool)) (string, error) {
+	name, op, word := expr, "", ""
+
+	if i := strings.Index(expr, ":"); i >= 0 {
+		name, op, word = expr[:i], expr[i:min(i+2, len(expr))], expr[min(i+2, len(expr)):]
+	}
+
+	if !envNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid variable ${%s}", expr)
+	}
+
+	value, _ := lookup(name)
+
+	switch op {
+	case "":
+		return value, nil
+	case ":-":
+		if value != "" {
+			return value, nil
+		}
+
+		return interpolate(word, lookup)
+	case ":?":
+		if value != "" {
+			return value, nil
+		}
+
+		msg, err := interpolate(word, lookup)
+		if err != nil {
+			return "", err
+		}
+
+		if msg == "" {
+			msg = "not set"
+		}
+
+		return "", errors.New(name + ": " + msg)
+	default:
+		return "", fmt.Errorf("invalid variable ${%s}", expr)
+	}
+}
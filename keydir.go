@@ -0,0 +1,107 @@
+package king
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// credentialsDirectoryEnv is set by systemd to the directory with the
+// credentials of a service (LoadCredential=, SetCredential=).
+const credentialsDirectoryEnv = "CREDENTIALS_DIRECTORY"
+
+// KeyDirResolver resolves flags from a directory with one file per key,
+// as Kubernetes ConfigMap and Secret volumes or systemd credentials
+// provide them. Trailing newlines are removed from the values.
+//
+// A flag is looked up by its name, prefixed with its command section like
+// in configuration files ("server.listen", "listen"), and then by the
+// names EnvResolver reads ("APP_LISTEN"). The files are read on every
+// parse and symbolic links are followed, so updates that swap the
+// ..data link of a ConfigMap are picked up on the next reload.
+func KeyDirResolver(dir string) kong.Resolver {
+	var f kong.ResolverFunc = func(ctx *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
+		if ignoredFlagsNames[flag.Name] {
+			return nil, nil
+		}
+
+		for _, name := range keyFileNames(ctx.Model.Name, parent, flag) {
+			path := filepath.Join(dir, name)
+
+			info, err := os.Stat(path)
+			if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			data, err := os.ReadFile(filepath.Clean(path))
+			if err != nil {
+				return nil, err
+			}
+
+			return strings.TrimRight(string(data), "\r\n"), nil
+		}
+
+		return nil, nil
+	}
+
+	return f
+}
+
+// keyFileNames returns the file names of flag in the order they are looked
+// up.
+func keyFileNames(appName string, parent *kong.Path, flag *kong.Flag) []string {
+	s := sections(parent)
+	names := []string{}
+
+	for i := len(s); i >= 0; i-- {
+		names = append(names, strings.Join(append(s[:i:i], flag.Name), "."))
+	}
+
+	return append(names, envVarNames(appName, flag.Value)...)
+}
+
+// openKeyDir returns a KeyDirResolver for dir if it exists.
+func openKeyDir(dir string) (kong.Resolver, ConfigFile, error) {
+	f := ConfigFile{Path: dir, Status: StatusParsed}
+
+	info, err := os.Stat(dir)
+
+	switch {
+	case os.IsNotExist(err):
+		f.Status = StatusNotFound
+		return nil, f, nil
+	case os.IsPermission(err):
+		f.Status = StatusPermissionDenied
+		return nil, f, nil
+	case err != nil:
+		return nil, f, err
+	case !info.IsDir():
+		return nil, f, fmt.Errorf("%s: not a directory", dir)
+	}
+
+	return KeyDirResolver(dir), f, nil
+}
+
+// sensitiveResolver marks all values it resolves as sensitive.
+type sensitiveResolver struct {
+	kong.Resolver
+	tracker *tracker
+}
+
+func (r sensitiveResolver) Resolve(ctx *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
+	v, err := r.Resolver.Resolve(ctx, parent, flag)
+	if err == nil && v != nil {
+		r.tracker.markSensitive(ctx, flag.Name)
+	}
+
+	return v, err
+}
@@ -4,10 +4,14 @@ package king
 
 import (
 	"context"
+	"fmt"
+	"io/fs"
 	"maps"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/alecthomas/kong"
@@ -17,13 +21,31 @@ const redactChar = `*`
 
 // Config is used to create DefaultOptions.
 type Config struct {
-	Context      context.Context
-	Name         string
-	Description  string
-	BuildInfo    *BuildInfo
-	ConfigPaths  []string
-	Variables    map[string]string
-	FileResolver FileResolver
+	Context            context.Context
+	Name               string
+	Description        string
+	BuildInfo          *BuildInfo
+	ConfigPaths        []string
+	Variables          map[string]string
+	FileResolver       FileResolver
+	AdminSocket        string
+	Completion         bool
+	ConfigMode         ConfigMode
+	Interpolate        bool
+	SecretProviders    map[string]SecretProvider
+	AgeIdentityFile    string
+	DotEnvFiles        []string
+	KeyDirs            []string
+	Credentials        bool
+	Overlays           bool
+	Profiles           bool
+	Includes           bool
+	Layers             []Layer
+	PolicyFiles        []string
+	PolicyEnforcement  Enforcement
+	SourceEnforcement  Enforcement
+	EmbeddedConfig     fs.FS
+	EmbeddedConfigPath string
 }
 
 func (c Config) pathString() string {
@@ -31,17 +53,57 @@ func (c Config) pathString() string {
 }
 
 // DefaultOptions creates a set of opinionated options.
+//
+// Flag values are taken from the command line, environment variables,
+// Config.DotEnvFiles, systemd credentials (Config.Credentials),
+// Config.KeyDirs and configuration files, in this order of precedence.
+// Config.Layers changes the order of the layers below the command line,
+// layers that are not listed are disabled (see DefaultLayers). Without
+// LayerFile the flags --config and --env are not added and --profile only
+// applies to Config.EmbeddedConfig. Values of
+// Config.PolicyFiles override all of them, the file Config.EmbeddedConfigPath
+// of Config.EmbeddedConfig (e.g. an embed.FS) is the least important layer.
 func DefaultOptions(c Config) []kong.Option {
 	if c.FileResolver == "" {
 		c.FileResolver = YAML
 	}
 
+	if c.Layers == nil {
+		c.Layers = DefaultLayers()
+	}
+
+	if err := validateLayers(c.Layers); err != nil {
+		return []kong.Option{kong.OptionFunc(func(*kong.Kong) error {
+			return err
+		})}
+	}
+
 	if c.ConfigPaths == nil {
-		c.ConfigPaths = configsForApp(c.Name)
+		c.ConfigPaths = c.defaultConfigPaths()
+	}
+
+	// Without the file layer no configuration files are read, profiles
+	// still apply to the embedded configuration.
+	if !slices.Contains(c.Layers, LayerFile) {
+		c.ConfigMode = NoConfigFlag
+		c.Overlays = false
+		c.Profiles = c.Profiles && c.EmbeddedConfig != nil
+	}
+
+	if c.AdminSocket == "" {
+		c.AdminSocket = filepath.Join(c.RuntimeDir(), "admin.sock")
 	}
 
 	vars := kong.Vars{
-		configPathsKey: c.pathString(),
+		configPathsKey:  c.pathString(),
+		adminSocketKey:  c.AdminSocket,
+		fileResolverKey: string(c.FileResolver),
+		configEnvKey:    envVarName(c.Name, "config"),
+		overlayEnvKey:   envVarName(c.Name, "env"),
+		profileEnvKey:   envVarName(c.Name, "profile"),
+		profilesKey:     strconv.FormatBool(c.Profiles),
+		includesKey:     strconv.FormatBool(c.Includes),
+		layersKey:       c.precedence(),
 	}
 
 	maps.Copy(vars, c.Variables)
@@ -52,14 +114,17 @@ func DefaultOptions(c Config) []kong.Option {
 		maps.Copy(vars, c.BuildInfo.asMap("king_"))
 	}
 
+	t := &tracker{}
+
 	opts := []kong.Option{
 		kong.Name(c.Name),
 		kong.Description(c.Description),
-		kong.ValueFormatter(newHelpFormatter(c.Name)),
+		kong.ValueFormatter(newHelpFormatter(c.Name, slices.Contains(c.Layers, LayerEnv))),
 		kong.ConfigureHelp(kong.HelpOptions{
 			Compact: true,
 		}),
 		kong.UsageOnError(),
+		kong.Bind(t),
 		vars,
 	}
 
@@ -67,11 +132,42 @@ func DefaultOptions(c Config) []kong.Option {
 		opts = append(opts, bindContext(c.Context))
 	}
 
-	if len(c.ConfigPaths) > 0 {
-		opts = append(opts, kong.Configuration(NewFileResolver(c.FileResolver), c.ConfigPaths...), kong.Resolvers(EnvResolver()))
+	if !slices.Contains(c.Layers, LayerEnv) {
+		opts = append(opts, kong.PostBuild(disableEnvs))
+	}
+
+	if c.Completion {
+		opts = append(opts, kong.Embed(&completion{}))
+	}
+
+	if c.ConfigMode != NoConfigFlag {
+		opts = append(opts, kong.Embed(&configFlag{}))
+	}
+
+	if c.Overlays {
+		opts = append(opts, kong.Embed(&overlayFlag{}))
+	}
+
+	if c.Profiles {
+		opts = append(opts, kong.Embed(&profileFlag{}))
+	}
+
+	if len(c.ConfigPaths) > 0 || len(c.DotEnvFiles) > 0 || len(c.KeyDirs) > 0 || c.Credentials || c.ConfigMode != NoConfigFlag || len(c.PolicyFiles) > 0 || c.EmbeddedConfig != nil {
+		l := newLoader(c, t)
+
+		opts = append(opts,
+			kong.Configuration(NewFileResolver(c.FileResolver)),
+			kong.Bind(l),
+			kong.WithBeforeResolve(l.beforeResolve),
+			kong.WithBeforeApply(l.beforeApply),
+		)
+
+		if len(c.PolicyFiles) > 0 {
+			opts = append(opts, kong.PostBuild(l.markLocked))
+		}
 	}
 
-	return opts
+	return append(opts, kong.WithBeforeApply(checkSources(c.SourceEnforcement)))
 }
 
 // Map is a map with string as key and interface{} as value.
@@ -81,15 +177,17 @@ type Map map[string]any
 //
 // To prevent logging sensitive flag values it is possible to provide
 // a list of regular expressions. Flag values of flag names that match are
-// redacted by '*'.
+// redacted by '*'. Values of flags with a `sensitive:""` tag and values
+// resolved by a SecretProvider are always redacted.
 func FlagMap(ctx *kong.Context, redactFlags ...*regexp.Regexp) Map {
+	r := redactor(redactFlags)
+	t := trackerFor(ctx)
 	m := Map{}
+
 	for _, f := range ctx.Flags() {
-		m[f.Name] = ctx.FlagValue(f)
+		m[f.Name] = redactValue(ctx, t, f, r)
 	}
 
-	m = m.redact(redactFlags...)
-
 	b := newBuildInfo("king_", ctx.Model.Vars())
 	if b != nil {
 		m[buildInfoKey] = b
@@ -101,17 +199,6 @@ func FlagMap(ctx *kong.Context, redactFlags ...*regexp.Regexp) Map {
 	return m
 }
 
-func (m Map) redact(keyRegexp ...*regexp.Regexp) Map {
-	r := redactor(keyRegexp)
-	nm := Map{}
-
-	for k, v := range m {
-		nm[k] = r(k, v)
-	}
-
-	return nm
-}
-
 // Add adds key and values.
 func (m Map) Add(keyVals ...string) Map {
 	nm := Map{}
@@ -193,12 +280,28 @@ func redactor(targets []*regexp.Regexp) func(string, any) any {
 	}
 }
 
+// redactValue returns the value of flag f redacted by r. Sensitive values
+// are redacted regardless of their type.
+func redactValue(ctx *kong.Context, t *tracker, f *kong.Flag, r func(string, any) any) any {
+	v := ctx.FlagValue(f)
+
+	if isSensitive(f.Value) || t.isSensitive(ctx, f.Name) {
+		return strings.Repeat(string(redactChar), len(fmt.Sprint(v)))
+	}
+
+	return r(f.Name, v)
+}
+
 func contains(list []string, item string) bool {
 	return slices.Contains(list, item)
 }
 
-func newHelpFormatter(appName string) func(*kong.Value) string {
+func newHelpFormatter(appName string, env bool) func(*kong.Value) string {
 	return func(value *kong.Value) string {
+		if !env {
+			return value.Help
+		}
+
 		var suffix string
 
 		if len(value.Tag.Envs) == 0 {
@@ -1,14 +1,27 @@
 package king_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"sort"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"filippo.io/age"
 	"github.com/alecthomas/kong"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
@@ -49,6 +62,21 @@ func writeFile(t *testing.T, data []byte) (filePath string, cleanup func()) {
 	}
 }
 
+// newTestParser returns a parser for cli with the options of c. The output
+// is written to the returned builder and exit is a no-op.
+func newTestParser(t *testing.T, c king.Config, cli any) (*kong.Kong, *strings.Builder) {
+	t.Helper()
+
+	buf := &strings.Builder{}
+	opts := king.DefaultOptions(c)
+	opts = append(opts, kong.Writers(buf, buf), kong.Exit(func(int) {}))
+
+	parser, err := kong.New(cli, opts...)
+	require.NoError(t, err)
+
+	return parser, buf
+}
+
 type cli struct {
 	FromFlag        string `help:"Value from flag."`
 	FromAutoEnv     string `help:"From auto env."`
@@ -272,3 +300,2313 @@ func TestFlagMap(t *testing.T) {
 
 	assert.Equal(t, expectedLabels, labels)
 }
+
+func TestHandlers(t *testing.T) {
+	cleanup := tempEnv(envMap{
+		"TEST_FROM_AUTO_ENV": "fromAutoEnv",
+	})
+
+	defer cleanup()
+
+	path, cleanUpFile := writeFile(t, []byte(`from-config: fromConfig`))
+	defer cleanUpFile()
+
+	b, err := king.NewBuildInfo("1.0.0", king.WithRevision("12345678"))
+	require.NoError(t, err)
+
+	c := cli{}
+	opts := king.DefaultOptions(
+		king.Config{
+			Name:        "test",
+			Description: "A application to test.",
+			ConfigPaths: []string{path},
+		},
+	)
+	parser, err := kong.New(&c, opts...)
+	require.NoError(t, err)
+
+	ctx, err := parser.Parse([]string{"--from-flag=fromFlag", "--override-config=secret"})
+	require.NoError(t, err)
+
+	t.Run("version", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		king.VersionHandler(b.Version("test")).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+		v := king.Version{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &v))
+		assert.Equal(t, b.Version("test"), v)
+	})
+
+	t.Run("config json", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		king.ConfigHandler(ctx, regexp.MustCompile("override-config")).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+		s := king.Settings{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &s))
+		assert.Equal(t, king.Setting{Value: "fromFlag", Origin: king.Origin{Source: king.SourceFlag}}, s["from-flag"])
+		assert.Equal(t, king.Setting{Value: "fromAutoEnv", Origin: king.Origin{Source: king.SourceEnv, Location: "TEST_FROM_AUTO_ENV"}}, s["from-auto-env"])
+		assert.Equal(t, king.Setting{Value: "fromConfig", Origin: king.Origin{Source: king.SourceFile, Location: path}}, s["from-config"])
+		assert.Equal(t, king.Setting{Value: "******", Origin: king.Origin{Source: king.SourceFlag}}, s["override-config"])
+		assert.Equal(t, king.Setting{Value: "", Origin: king.Origin{Source: king.SourceDefault}}, s["override-env"])
+	})
+
+	t.Run("config yaml", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		king.ConfigHandler(ctx).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config?format=yaml", nil))
+
+		assert.Equal(t, "application/yaml", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), "from-config:\n    value: fromConfig\n    source: file\n")
+	})
+}
+
+func TestAdmin(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	b, err := king.NewBuildInfo("1.0.0", king.WithRevision("12345678"))
+	require.NoError(t, err)
+
+	opts := king.DefaultOptions(
+		king.Config{
+			Name:        "test",
+			Description: "A application to test.",
+			BuildInfo:   b,
+			ConfigPaths: []string{"/does/not/exist.yaml"},
+			AdminSocket: socket,
+		},
+	)
+	buf := &strings.Builder{}
+	opts = append(opts, kong.Writers(buf, buf))
+
+	c := struct {
+		Token string        `help:"The token."`
+		Admin king.AdminCmd `cmd:"" help:"Talk to a running instance."`
+	}{}
+
+	parser, err := kong.New(&c, opts...)
+	require.NoError(t, err)
+
+	server, err := parser.Parse([]string{"--token=secret", "admin", "status"})
+	require.NoError(t, err)
+
+	reloaded := false
+	level := &slog.LevelVar{}
+	a := king.NewAdmin(server,
+		king.WithRedact(regexp.MustCompile("token")),
+		king.WithLogLevel(func() string { return level.Level().String() }),
+		king.WithReload(func() error {
+			reloaded = true
+			return nil
+		}),
+	)
+	require.NoError(t, a.Listen())
+
+	go a.Serve() // nolint: errcheck
+
+	defer a.Shutdown(context.Background()) // nolint: errcheck
+
+	t.Run("status", func(t *testing.T) {
+		buf.Reset()
+
+		ctx, err := parser.Parse([]string{"admin", "status"})
+		require.NoError(t, err)
+		require.NoError(t, ctx.Run())
+
+		assert.Contains(t, buf.String(), "test, version 1.0.0 (revision: 12345678)")
+		assert.Contains(t, buf.String(), "Log level: INFO")
+		assert.Contains(t, buf.String(), "/does/not/exist.yaml not found")
+		assert.Regexp(t, `token +\*{6} +\(flag\)`, buf.String())
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		buf.Reset()
+
+		ctx, err := parser.Parse([]string{"admin", "reload"})
+		require.NoError(t, err)
+		require.NoError(t, ctx.Run())
+
+		assert.True(t, reloaded)
+		assert.Equal(t, "reloaded\n", buf.String())
+	})
+}
+
+func TestAdminSocketPath(t *testing.T) {
+	parser, err := kong.New(&struct{}{}, king.DefaultOptions(king.Config{Name: "test", ConfigPaths: []string{}})...)
+	require.NoError(t, err)
+
+	ctx, err := parser.Parse([]string{})
+	require.NoError(t, err)
+
+	t.Run("regular file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "admin.sock")
+		require.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+
+		err := king.NewAdmin(ctx, king.WithSocket(path)).Listen()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "is not a socket")
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "data", string(data))
+	})
+
+	t.Run("stale socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "admin.sock")
+		l, err := net.Listen("unix", path)
+		require.NoError(t, err)
+
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		require.NoError(t, l.Close())
+
+		a := king.NewAdmin(ctx, king.WithSocket(path))
+		require.NoError(t, a.Listen())
+		require.NoError(t, a.Shutdown(context.Background()))
+	})
+
+	t.Run("shared directory", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "shared")
+		require.NoError(t, os.Mkdir(dir, 0o700))
+		require.NoError(t, os.Chmod(dir, 0o777)) // nolint: gosec
+
+		err := king.NewAdmin(ctx, king.WithSocket(filepath.Join(dir, "admin.sock"))).Listen()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "is writable by other users")
+	})
+}
+
+func TestEnvHelp(t *testing.T) {
+	cleanup := tempEnv(envMap{
+		"TEST_LISTEN": ":8080",
+		"TEST_TOKEN":  "secret",
+	})
+
+	defer cleanup()
+
+	c := struct {
+		Listen  string           `help:"The listen address." default:":3001"`
+		Timeout time.Duration    `help:"The timeout." default:"5s"`
+		Token   string           `help:"The token." sensitive:""`
+		Level   string           `help:"The log level." env:"LOG_LEVEL"`
+		EnvHelp king.EnvHelpFlag `help:"Show environment variables."`
+	}{}
+
+	buf := &strings.Builder{}
+	opts := king.DefaultOptions(
+		king.Config{
+			Name:        "test",
+			Description: "A application to test.",
+		},
+	)
+	opts = append(opts, kong.Writers(buf, buf))
+	parser, err := kong.New(&c, opts...)
+	require.NoError(t, err)
+
+	parser.Exit = func(int) {}
+
+	t.Run("table", func(t *testing.T) {
+		buf.Reset()
+
+		_, err = parser.Parse([]string{"--env-help"})
+		require.NoError(t, err)
+
+		expected := `VARIABLE      FLAG       TYPE      DEFAULT  SET       HELP
+LOG_LEVEL     --level    string             -         The log level.
+TEST_LEVEL    --level    string             -         The log level.
+TEST_LISTEN   --listen   string    :3001    ":8080"   The listen address.
+TEST_TIMEOUT  --timeout  duration  5s       -         The timeout.
+TEST_TOKEN    --token    string             "******"  The token.
+`
+		assert.Equal(t, expected, buf.String())
+	})
+
+	t.Run("dotenv", func(t *testing.T) {
+		buf.Reset()
+
+		_, err = parser.Parse([]string{"--env-help=dotenv"})
+		require.NoError(t, err)
+
+		assert.Contains(t, buf.String(), "# The listen address.\n# flag: --listen, type: string\nTEST_LISTEN=:3001\n")
+		assert.Contains(t, buf.String(), "\n# TEST_TOKEN=\n")
+		assert.Contains(t, buf.String(), "\n# TEST_LEVEL=\n")
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		_, err = parser.Parse([]string{"--env-help=xml"})
+		require.Error(t, err)
+	})
+}
+
+type sampleCLI struct {
+	Listen       string                `help:"The listen address." default:":3001"`
+	Timeout      time.Duration         `help:"The timeout." default:"5s"`
+	Token        string                `help:"The token." sensitive:""`
+	Verbose      int                   `help:"Verbosity." type:"counter"`
+	Labels       map[string]string     `help:"The labels." default:"a=1"`
+	Peers        []string              `help:"The peers." default:"a,b"`
+	Debug        bool                  `help:"Enable debug."`
+	SampleConfig king.SampleConfigFlag `help:"Print a sample config file."`
+	Server       struct {
+		Workers int `help:"Number of workers." default:"4"`
+	} `cmd:"" help:"Start the server."`
+}
+
+func TestSampleConfig(t *testing.T) {
+	for _, f := range []king.FileResolver{king.YAML, king.TOML, king.INI, king.Properties} {
+		t.Run(string(f), func(t *testing.T) {
+			buf := &strings.Builder{}
+			c := sampleCLI{}
+			opts := king.DefaultOptions(
+				king.Config{
+					Name:         "test",
+					Description:  "A application to test.",
+					FileResolver: f,
+				},
+			)
+			opts = append(opts, kong.Writers(buf, buf))
+			parser, err := kong.New(&c, opts...)
+			require.NoError(t, err)
+
+			parser.Exit = func(int) {}
+			_, err = parser.Parse([]string{"--sample-config", "server"})
+			require.NoError(t, err)
+
+			sample := buf.String()
+			assert.Contains(t, sample, "# The token.\n# token")
+
+			// Change the value in the command section to check the nesting.
+			sample = strings.Replace(sample, "workers: 4", "workers: 8", 1)
+			sample = strings.Replace(sample, "workers = 4", "workers = 8", 1)
+			sample = strings.Replace(sample, "server.workers=4", "server.workers=8", 1)
+
+			path, cleanUpFile := writeFile(t, []byte(sample))
+			defer cleanUpFile()
+
+			c = sampleCLI{}
+			parser, err = kong.New(&c, king.DefaultOptions(
+				king.Config{
+					Name:         "test",
+					ConfigPaths:  []string{path},
+					FileResolver: f,
+				},
+			)...)
+			require.NoError(t, err)
+			_, err = parser.Parse([]string{"server"})
+			require.NoError(t, err)
+
+			assert.Equal(t, ":3001", c.Listen)
+			assert.Equal(t, 5*time.Second, c.Timeout)
+			assert.Equal(t, map[string]string{"a": "1"}, c.Labels)
+			assert.Equal(t, []string{"a", "b"}, c.Peers)
+			assert.Equal(t, 8, c.Server.Workers)
+		})
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	c := struct {
+		Listen     string              `help:"The listen address." default:":3001" required:""`
+		Timeout    time.Duration       `help:"The timeout." default:"5s"`
+		Verbose    int                 `help:"Verbosity." type:"counter"`
+		Level      string              `help:"The log level." enum:"debug,info" default:"info"`
+		Labels     map[string]int      `help:"The labels."`
+		Peers      []string            `help:"The peers."`
+		JSONSchema king.JSONSchemaFlag `help:"Print the JSON schema."`
+		Server     struct {
+			Workers int `help:"Number of workers." required:""`
+		} `cmd:"" help:"Start the server."`
+	}{}
+
+	parser, err := kong.New(&c, king.DefaultOptions(king.Config{Name: "test", Description: "A application to test."})...)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(king.JSONSchema(parser.Model))
+	require.NoError(t, err)
+
+	expected := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "test",
+  "description": "A application to test.",
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["listen"],
+  "properties": {
+    "listen": {"type": "string", "description": "The listen address.", "default": ":3001"},
+    "timeout": {"type": "string", "description": "The timeout.", "default": "5s", "pattern": "^[-+]?([0-9]+(\\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$"},
+    "verbose": {"type": "integer", "description": "Verbosity.", "minimum": 0},
+    "level": {"type": "string", "description": "The log level.", "enum": ["debug", "info"], "default": "info"},
+    "labels": {"type": "object", "description": "The labels.", "additionalProperties": {"type": "integer"}},
+    "peers": {"type": "array", "description": "The peers.", "items": {"type": "string"}},
+    "workers": {"type": "integer", "description": "Number of workers."},
+    "server": {
+      "type": "object",
+      "description": "Start the server.",
+      "additionalProperties": false,
+      "required": ["workers"],
+      "properties": {
+        "workers": {"type": "integer", "description": "Number of workers."}
+      }
+    }
+  }
+}`
+	assert.JSONEq(t, expected, string(data))
+
+	aliased := struct {
+		DBHost string `name:"db-host" help:"The database host." config:"database" required:""`
+	}{}
+
+	parser, err = kong.New(&aliased, king.DefaultOptions(king.Config{Name: "test"})...)
+	require.NoError(t, err)
+
+	data, err = json.Marshal(king.JSONSchema(parser.Model))
+	require.NoError(t, err)
+
+	host := `{"type": "string", "description": "The database host."}`
+	expected = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "test",
+  "type": "object",
+  "additionalProperties": false,
+  "allOf": [{"anyOf": [{"required": ["db-host"]}, {"required": ["db_host"]}, {"required": ["dbHost"]}, {"required": ["db"]}, {"required": ["database"]}]}],
+  "properties": {
+    "db-host": ` + host + `,
+    "db_host": ` + host + `,
+    "dbHost": ` + host + `,
+    "db": {"type": "object", "additionalProperties": false, "properties": {"host": ` + host + `}},
+    "database": ` + host + `
+  }
+}`
+	assert.JSONEq(t, expected, string(data))
+}
+
+func TestCompletion(t *testing.T) {
+	c := struct {
+		Level  string `help:"The log level." enum:"debug,info" default:"info"`
+		Config string `help:"The config file." type:"path"`
+		Server struct {
+			Workers int `help:"Number of workers."`
+		} `cmd:"" help:"Start the server."`
+	}{}
+
+	buf := &strings.Builder{}
+	opts := king.DefaultOptions(
+		king.Config{
+			Name:       "test",
+			Completion: true,
+		},
+	)
+	opts = append(opts, kong.Writers(buf, buf))
+	parser, err := kong.New(&c, opts...)
+	require.NoError(t, err)
+
+	parser.Exit = func(int) {}
+
+	for shell, expected := range map[string][]string{
+		king.Bash: {
+			`':server') cmd='server' ;;`,
+			`--level) COMPREPLY=($(compgen -W 'debug info' -- "${cur}")); return ;;`,
+			`--config) COMPREPLY=($(compgen -f -- "${cur}")); return ;;`,
+			`'server') flags='--help -h --level --config --completion --workers'; commands='' ;;`,
+			`complete -F _test_completion test`,
+		},
+		king.Zsh: {
+			`--level) compadd -- 'debug' 'info'; return ;;`,
+			`--config) _files; return ;;`,
+			`commands=('server:Start the server.')`,
+			`compdef _test test`,
+		},
+		king.Fish: {
+			`complete -c test -n '__fish_use_subcommand' -a 'server' -d 'Start the server.'`,
+			`complete -c test -l level -x -a 'debug info' -d 'The log level.'`,
+			`complete -c test -l config -r -F -d 'The config file.'`,
+			`complete -c test -n '__fish_seen_subcommand_from server' -l workers -x -d 'Number of workers.'`,
+		},
+	} {
+		t.Run(shell, func(t *testing.T) {
+			buf.Reset()
+
+			_, err = parser.Parse([]string{"--completion=" + shell, "server"})
+			require.NoError(t, err)
+
+			for _, e := range expected {
+				assert.Contains(t, buf.String(), e)
+			}
+		})
+	}
+
+	_, err = parser.Parse([]string{"--completion=tcsh", "server"})
+	require.Error(t, err)
+
+	t.Run("fish paths", func(t *testing.T) {
+		type startCmd struct {
+			Workers int `help:"Number of workers."`
+		}
+
+		nested := struct {
+			Server struct {
+				Start startCmd `cmd:"" aliases:"run" help:"Start the server."`
+			} `cmd:"" help:"Server commands."`
+			Client struct {
+				Start startCmd `cmd:"" help:"Start the client."`
+			} `cmd:"" help:"Client commands."`
+		}{}
+
+		parser, buf := newTestParser(t, king.Config{Name: "test", Completion: true}, &nested)
+
+		_, err := parser.Parse([]string{"--completion=" + king.Fish, "client", "start"})
+		require.NoError(t, err)
+
+		for _, e := range []string{
+			`complete -c test -n '__fish_seen_subcommand_from server; and __fish_seen_subcommand_from start run' -l workers -x -d 'Number of workers.'`,
+			`complete -c test -n '__fish_seen_subcommand_from client; and __fish_seen_subcommand_from start' -l workers -x -d 'Number of workers.'`,
+		} {
+			assert.Equal(t, 1, strings.Count(buf.String(), e+"\n"), e)
+		}
+	})
+}
+
+func TestDocs(t *testing.T) {
+	b, err := king.NewBuildInfo("1.0.0",
+		king.WithDateString("2020-09-22T11:11:10+02:00"),
+		king.WithRevision("12345678"),
+	)
+	require.NoError(t, err)
+
+	c := struct {
+		Listen string        `help:"The listen address." default:":3001"`
+		Level  string        `help:"The log level." env:"LOG_LEVEL"`
+		Docs   king.DocsFlag `help:"Print the documentation."`
+		Server struct {
+			Workers int `help:"Number of workers."`
+		} `cmd:"" help:"Start the server."`
+	}{}
+
+	buf := &strings.Builder{}
+	opts := king.DefaultOptions(
+		king.Config{
+			Name:        "test",
+			Description: "A application to test.",
+			BuildInfo:   b,
+			ConfigPaths: []string{"/etc/test/config.yaml"},
+		},
+	)
+	opts = append(opts, kong.Writers(buf, buf))
+	parser, err := kong.New(&c, opts...)
+	require.NoError(t, err)
+
+	parser.Exit = func(int) {}
+
+	t.Run("markdown", func(t *testing.T) {
+		buf.Reset()
+
+		_, err = parser.Parse([]string{"--docs=markdown", "server"})
+		require.NoError(t, err)
+
+		for _, e := range []string{
+			"# test\n\nA application to test.\n\nVersion 1.0.0 (revision: 12345678, build date: 2020-09-22T09:11:10Z)\n",
+			"| `--listen=\":3001\"` | `TEST_LISTEN` | `listen` | `:3001` | The listen address. |\n",
+			"| `--level=STRING` | `TEST_LEVEL`, `LOG_LEVEL` | `level` |  | The log level. |\n",
+			"### test server\n\nStart the server.\n\n```\ntest server [flags]\n```\n",
+			"| `--workers=INT` | `TEST_WORKERS` | `server.workers` |  | Number of workers. |\n",
+			"- `/etc/test/config.yaml`\n",
+		} {
+			assert.Contains(t, buf.String(), e)
+		}
+	})
+
+	t.Run("man", func(t *testing.T) {
+		buf.Reset()
+
+		_, err = parser.Parse([]string{"--docs=man", "server"})
+		require.NoError(t, err)
+
+		for _, e := range []string{
+			`.TH "TEST" 1 "2020\-09\-22" "test 1.0.0" "User Commands"`,
+			".TP\n\\fB\\-\\-workers=INT\\fR\nNumber of workers.\n.br\nEnvironment: TEST_WORKERS\n.br\nConfig key: server.workers\n",
+			".SH FILES",
+			".I /etc/test/config.yaml",
+		} {
+			assert.Contains(t, buf.String(), e)
+		}
+	})
+}
+
+func TestXDG(t *testing.T) {
+	cleanup := tempEnv(envMap{
+		"XDG_CONFIG_HOME": "/home/test/.config",
+		"XDG_CONFIG_DIRS": "/etc/xdg1:relative:/etc/xdg2",
+		"XDG_DATA_HOME":   "/home/test/.local/share",
+		"XDG_CACHE_HOME":  "relative",
+		"XDG_STATE_HOME":  "/home/test/.local/state",
+	})
+
+	defer cleanup()
+
+	cfg := king.Config{
+		Name:         "test",
+		FileResolver: king.TOML,
+	}
+
+	parser, err := kong.New(&cli{}, king.DefaultOptions(cfg)...)
+	require.NoError(t, err)
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+
+	expected := []string{
+		"/etc/test/config.toml",
+		"/etc/xdg2/test/config.toml",
+		"/etc/xdg1/test/config.toml",
+		"/home/test/.config/test/config.toml",
+		filepath.Join(cwd, "test.toml"),
+	}
+	assert.Equal(t, expected, king.Configs(parser.Model.Vars()))
+
+	assert.Equal(t, "/home/test/.config/test", cfg.ConfigDir())
+	assert.Equal(t, "/home/test/.local/share/test", cfg.DataDir())
+	assert.Equal(t, filepath.Join(home, ".cache/test"), cfg.CacheDir())
+	assert.Equal(t, "/home/test/.local/state/test", cfg.StateDir())
+}
+
+func TestXDGPrecedence(t *testing.T) {
+	type xdgCLI struct {
+		First  string `help:"First."`
+		Second string `help:"Second."`
+		Third  string `help:"Third."`
+		Fourth string `help:"Fourth."`
+	}
+
+	dir := t.TempDir()
+
+	for path, content := range map[string]string{
+		"xdg2/test/config.yaml":   "first: xdg2\nsecond: xdg2\nthird: xdg2\nfourth: xdg2\n",
+		"xdg1/test/config.yaml":   "first: xdg1\nsecond: xdg1\nthird: xdg1\n",
+		"config/test/config.yaml": "first: home\nsecond: home\n",
+		"cwd/test.yaml":           "first: cwd\n",
+	} {
+		path = filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	cleanup := tempEnv(envMap{
+		"XDG_CONFIG_HOME": filepath.Join(dir, "config"),
+		"XDG_CONFIG_DIRS": filepath.Join(dir, "xdg1") + ":" + filepath.Join(dir, "xdg2"),
+	})
+
+	defer cleanup()
+
+	t.Chdir(filepath.Join(dir, "cwd"))
+
+	c := xdgCLI{}
+	parser, err := kong.New(&c, king.DefaultOptions(king.Config{Name: "test"})...)
+	require.NoError(t, err)
+
+	_, err = parser.Parse([]string{})
+	require.NoError(t, err)
+	assert.Equal(t, xdgCLI{First: "cwd", Second: "home", Third: "xdg1", Fourth: "xdg2"}, c)
+}
+
+type configCLI struct {
+	ShowConfig king.ShowConfig `help:"Show configuration files."`
+	FromConfig string          `help:"From config."`
+	Other      string          `help:"Other value."`
+}
+
+func TestConfigFlag(t *testing.T) {
+	search, cleanUpSearch := writeFile(t, []byte("from-config: fromSearch\nother: fromSearch\n"))
+	defer cleanUpSearch()
+
+	explicit, cleanUpExplicit := writeFile(t, []byte("from-config: fromExplicit\n"))
+	defer cleanUpExplicit()
+
+	newParser := func(t *testing.T, mode king.ConfigMode, c *configCLI) (*kong.Kong, *strings.Builder) {
+		t.Helper()
+
+		return newTestParser(t, king.Config{Name: "test", ConfigPaths: []string{search}, ConfigMode: mode}, c)
+	}
+
+	t.Run("replace", func(t *testing.T) {
+		c := configCLI{}
+		parser, _ := newParser(t, king.ConfigFlagReplace, &c)
+		_, err := parser.Parse([]string{"--config", explicit})
+		require.NoError(t, err)
+		assert.Equal(t, configCLI{FromConfig: "fromExplicit"}, c)
+	})
+
+	t.Run("prepend", func(t *testing.T) {
+		c := configCLI{}
+		parser, _ := newParser(t, king.ConfigFlagPrepend, &c)
+		_, err := parser.Parse([]string{"--config", explicit})
+		require.NoError(t, err)
+		assert.Equal(t, configCLI{FromConfig: "fromExplicit", Other: "fromSearch"}, c)
+	})
+
+	t.Run("env", func(t *testing.T) {
+		cleanup := tempEnv(envMap{
+			"TEST_CONFIG": explicit,
+		})
+
+		defer cleanup()
+
+		c := configCLI{}
+		parser, _ := newParser(t, king.ConfigFlagReplace, &c)
+		ctx, err := parser.Parse([]string{})
+		require.NoError(t, err)
+		assert.Equal(t, configCLI{FromConfig: "fromExplicit"}, c)
+
+		files, err := king.EffectiveConfigFiles(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []king.ConfigFile{{Path: explicit, Status: king.StatusParsed, Keys: []string{"from-config"}}}, files)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		parser, _ := newParser(t, king.ConfigFlagReplace, &configCLI{})
+		_, err := parser.Parse([]string{"--config", "/does/not/exist.yaml"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "config file:")
+	})
+
+	t.Run("stdin", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+
+		stdin := os.Stdin
+		os.Stdin = r
+
+		defer func() {
+			os.Stdin = stdin
+		}()
+
+		_, err = w.WriteString("other: fromStdin\n")
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		c := configCLI{}
+		parser, _ := newParser(t, king.ConfigFlagReplace, &c)
+		_, err = parser.Parse([]string{"--config", explicit, "--config", "-"})
+		require.NoError(t, err)
+		assert.Equal(t, configCLI{FromConfig: "fromExplicit", Other: "fromStdin"}, c)
+	})
+
+	t.Run("show config", func(t *testing.T) {
+		parser, buf := newParser(t, king.ConfigFlagPrepend, &configCLI{})
+		_, err := parser.Parse([]string{"--config", explicit, "--show-config"})
+		require.NoError(t, err)
+		assert.Regexp(t, regexp.QuoteMeta(search)+` +parsed +from-config, other\n +`+regexp.QuoteMeta(explicit)+` +parsed +from-config\n`, buf.String())
+	})
+
+	t.Run("no flag", func(t *testing.T) {
+		parser, _ := newParser(t, king.NoConfigFlag, &configCLI{})
+		_, err := parser.Parse([]string{"--config", explicit})
+		require.Error(t, err)
+	})
+}
+
+func TestConfigDropIns(t *testing.T) {
+	dir := t.TempDir()
+	confd := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.Mkdir(confd, 0o750))
+
+	for name, content := range map[string]string{
+		"config.yaml":          "from-config: fromConfig\nother: fromConfig\n",
+		"conf.d/20-b.yaml":     "other: fromB\n",
+		"conf.d/10-a.yaml":     "from-config: fromA\nother: fromA\n",
+		"conf.d/.hidden.yaml":  "other: fromHidden\n",
+		"conf.d/notes.txt":     "other: fromNotes\n",
+		"conf.d/sub/skip.yaml": "other: fromSub\n",
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	for _, tc := range []struct {
+		name  string
+		paths []string
+	}{
+		{"directory", []string{filepath.Join(dir, "config.yaml"), confd}},
+		{"glob", []string{filepath.Join(dir, "config.yaml"), filepath.Join(confd, "*.yaml")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := configCLI{}
+			parser, buf := newTestParser(t, king.Config{Name: "test", ConfigPaths: tc.paths}, &c)
+
+			ctx, err := parser.Parse([]string{})
+			require.NoError(t, err)
+			assert.Equal(t, configCLI{FromConfig: "fromA", Other: "fromB"}, c)
+
+			files, err := king.EffectiveConfigFiles(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []king.ConfigFile{
+				{Path: filepath.Join(dir, "config.yaml"), Status: king.StatusParsed, Keys: []string{"from-config", "other"}},
+				{Path: filepath.Join(confd, "10-a.yaml"), Status: king.StatusParsed, Keys: []string{"from-config", "other"}},
+				{Path: filepath.Join(confd, "20-b.yaml"), Status: king.StatusParsed, Keys: []string{"other"}},
+			}, files)
+
+			_, err = parser.Parse([]string{"--show-config"})
+			require.NoError(t, err)
+			assert.Contains(t, buf.String(), filepath.Join(confd, "20-b.yaml")+" parsed other\n")
+		})
+	}
+
+	t.Run("no match", func(t *testing.T) {
+		pattern := filepath.Join(dir, "missing.d", "*.yaml")
+		parser, err := kong.New(&configCLI{}, king.DefaultOptions(king.Config{
+			Name:        "test",
+			ConfigPaths: []string{pattern},
+		})...)
+		require.NoError(t, err)
+
+		ctx, err := parser.Parse([]string{})
+		require.NoError(t, err)
+
+		files, err := king.EffectiveConfigFiles(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []king.ConfigFile{{Path: pattern, Status: king.StatusNotFound}}, files)
+	})
+}
+
+func TestInterpolation(t *testing.T) {
+	cleanup := tempEnv(envMap{
+		"KING_HOST":  "example.com",
+		"KING_EMPTY": "",
+	})
+
+	defer cleanup()
+
+	type interpolationCLI struct {
+		URL     string   `help:"URL."`
+		Default string   `help:"Default."`
+		Price   string   `help:"Price."`
+		Hosts   []string `help:"Hosts."`
+		Missing string   `help:"Missing."`
+	}
+
+	parse := func(t *testing.T, content string, interpolate bool) (interpolationCLI, error) {
+		t.Helper()
+
+		path, cleanUpFile := writeFile(t, []byte(content))
+		t.Cleanup(cleanUpFile)
+
+		c := interpolationCLI{}
+		parser, _ := newTestParser(t, king.Config{Name: "test", ConfigPaths: []string{path}, Interpolate: interpolate}, &c)
+
+		_, err := parser.Parse([]string{})
+
+		return c, err
+	}
+
+	content := `url: "https://${KING_HOST}:${KING_PORT:-8080}/"
+default: "${KING_EMPTY:-${KING_HOST}}"
+price: "$$5 and $HOME"
+hosts:
+  - "${KING_HOST}"
+  - "${KING_UNSET}"
+`
+
+	t.Run("enabled", func(t *testing.T) {
+		c, err := parse(t, content, true)
+		require.NoError(t, err)
+		assert.Equal(t, interpolationCLI{
+			URL:     "https://example.com:8080/",
+			Default: "example.com",
+			Price:   "$5 and $HOME",
+			Hosts:   []string{"example.com", ""},
+		}, c)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		c, err := parse(t, content, false)
+		require.NoError(t, err)
+		assert.Equal(t, "https://${KING_HOST}:${KING_PORT:-8080}/", c.URL)
+	})
+
+	t.Run("required", func(t *testing.T) {
+		_, err := parse(t, `missing: "${KING_EMPTY:?must be set}"`, true)
+		require.Error(t, err)
+		assert.Regexp(t, `test\d+: missing: KING_EMPTY: must be set$`, err.Error())
+
+		_, err = parse(t, `missing: "${KING_UNSET:?}"`, true)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "missing: KING_UNSET: not set")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parse(t, `missing: "${KING_HOST"`, true)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "missing: unterminated variable")
+
+		_, err = parse(t, `missing: "${KING-HOST}"`, true)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "missing: invalid variable ${KING-HOST}")
+	})
+}
+
+func TestSecretProviders(t *testing.T) {
+	cleanup := tempEnv(envMap{
+		"KING_DB_PASSWORD": "fromEnv",
+	})
+
+	defer cleanup()
+
+	secret, cleanUpSecret := writeFile(t, []byte("fromFile\n"))
+	defer cleanUpSecret()
+
+	type secretCLI struct {
+		Memory string   `help:"Memory."`
+		File   string   `help:"File."`
+		Env    string   `help:"Env."`
+		Exec   string   `help:"Exec."`
+		URL    string   `help:"URL."`
+		Plain  string   `help:"Plain."`
+		List   []string `help:"List."`
+	}
+
+	providers := king.DefaultSecretProviders()
+	providers["mem"] = king.MapSecretProvider{"db": "fromMemory"}
+
+	parse := func(t *testing.T, content string) (secretCLI, *kong.Context, error) {
+		t.Helper()
+
+		path, cleanUpFile := writeFile(t, []byte(content))
+		t.Cleanup(cleanUpFile)
+
+		c := secretCLI{}
+		parser, _ := newTestParser(t, king.Config{Name: "test", ConfigPaths: []string{path}, SecretProviders: providers}, &c)
+
+		ctx, err := parser.Parse([]string{"--plain=cli"})
+
+		return c, ctx, err
+	}
+
+	t.Run("resolve", func(t *testing.T) {
+		c, ctx, err := parse(t, fmt.Sprintf(`memory: mem://db
+file: file://%s
+env: env://KING_DB_PASSWORD
+exec: exec://echo fromExec
+url: https://example.com
+list: [plain, "mem://db"]
+`, secret))
+		require.NoError(t, err)
+		assert.Equal(t, secretCLI{
+			Memory: "fromMemory",
+			File:   "fromFile",
+			Env:    "fromEnv",
+			Exec:   "fromExec",
+			URL:    "https://example.com",
+			Plain:  "cli",
+			List:   []string{"plain", "fromMemory"},
+		}, c)
+
+		m := king.FlagMap(ctx).Rm("help")
+		assert.Equal(t, "**********", m["memory"])
+		assert.Equal(t, "********", m["file"])
+		assert.Equal(t, "https://example.com", m["url"])
+		assert.Equal(t, "cli", m["plain"])
+		assert.Equal(t, strings.Repeat("*", len("[plain fromMemory]")), m["list"])
+
+		reg := prometheus.NewRegistry()
+		m.Rm("list").Register("program", reg)
+
+		families, err := reg.Gather()
+		require.NoError(t, err)
+
+		for _, f := range families {
+			for _, metric := range f.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "value" {
+						assert.NotContains(t, label.GetValue(), "from", "secret registered as metric")
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, _, err := parse(t, `memory: mem://unknown`)
+		require.Error(t, err)
+		assert.Regexp(t, `test\d+: memory: mem secret: secret "unknown" not found$`, err.Error())
+
+		_, _, err = parse(t, `env: env://KING_UNSET`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "env: env secret: environment variable KING_UNSET not set")
+	})
+}
+
+func TestEncryptedValues(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	identityFile, cleanUpIdentity := writeFile(t, []byte("# test key\n"+identity.String()+"\n"))
+	defer cleanUpIdentity()
+
+	type encryptedCLI struct {
+		Password string          `help:"Password."`
+		User     string          `help:"User."`
+		Serve    struct{}        `cmd:"" default:"1" help:"Serve."`
+		Encrypt  king.EncryptCmd `cmd:"" help:"Encrypt a value."`
+	}
+
+	encrypted, err := king.Encrypt("s3cret", identity.Recipient().String())
+	require.NoError(t, err)
+	assert.Regexp(t, `^ENC\[age,[A-Za-z0-9+/=]+\]$`, encrypted)
+
+	path, cleanUpFile := writeFile(t, fmt.Appendf(nil, "password: %s\nuser: admin\n", encrypted))
+	defer cleanUpFile()
+
+	parse := func(t *testing.T, identityFile string, args ...string) (encryptedCLI, *kong.Context, *strings.Builder, error) {
+		t.Helper()
+
+		c := encryptedCLI{}
+		parser, buf := newTestParser(t, king.Config{Name: "test", ConfigPaths: []string{path}, AgeIdentityFile: identityFile}, &c)
+
+		ctx, err := parser.Parse(args)
+
+		return c, ctx, buf, err
+	}
+
+	t.Run("config", func(t *testing.T) {
+		c, ctx, _, err := parse(t, identityFile)
+		require.NoError(t, err)
+		assert.Equal(t, "s3cret", c.Password)
+		assert.Equal(t, "admin", c.User)
+
+		m := king.FlagMap(ctx)
+		assert.Equal(t, "******", m["password"])
+		assert.Equal(t, "admin", m["user"])
+	})
+
+	t.Run("env", func(t *testing.T) {
+		cleanup := tempEnv(envMap{
+			"TEST_AGE_IDENTITY_FILE": identityFile,
+		})
+
+		defer cleanup()
+
+		c, _, _, err := parse(t, "/does/not/exist")
+		require.NoError(t, err)
+		assert.Equal(t, "s3cret", c.Password)
+	})
+
+	t.Run("no identity", func(t *testing.T) {
+		_, _, _, err := parse(t, "")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "password: age: no age identity file configured (set $TEST_AGE_IDENTITY_FILE)")
+	})
+
+	t.Run("wrong identity", func(t *testing.T) {
+		other, err := age.GenerateX25519Identity()
+		require.NoError(t, err)
+
+		otherFile, cleanUpOther := writeFile(t, []byte(other.String()))
+		defer cleanUpOther()
+
+		_, _, _, err = parse(t, otherFile)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "password: age: no identity matched any of the recipients")
+	})
+
+	t.Run("command", func(t *testing.T) {
+		in, w, err := os.Pipe()
+		require.NoError(t, err)
+
+		stdin := os.Stdin
+		os.Stdin = in
+
+		defer func() {
+			os.Stdin = stdin
+		}()
+
+		_, err = w.WriteString("value\n")
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		_, _, _, err = parse(t, identityFile, "encrypt", "-r", identity.Recipient().String(), "value")
+		require.Error(t, err)
+
+		_, ctx, buf, err := parse(t, identityFile, "encrypt", "-r", identity.Recipient().String())
+		require.NoError(t, err)
+		require.NoError(t, ctx.Run())
+
+		envelope := strings.TrimSpace(buf.String())
+		require.True(t, strings.HasPrefix(envelope, "ENC[age,"))
+
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(envelope, "ENC[age,"), "]"))
+		require.NoError(t, err)
+
+		r, err := age.Decrypt(bytes.NewReader(data), identity)
+		require.NoError(t, err)
+
+		plain, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "value", string(plain))
+	})
+}
+
+func TestDotEnv(t *testing.T) {
+	type dotEnvCLI struct {
+		Plain     string `help:"Plain."`
+		Comment   string `help:"Comment."`
+		Exported  string `help:"Exported."`
+		Single    string `help:"Single."`
+		Double    string `help:"Double."`
+		Multi     string `help:"Multi."`
+		Tagged    string `help:"Tagged." env:"TAGGED"`
+		FromFile  string `help:"From file."`
+		FromEnv   string `help:"From env."`
+		NotInFile string `help:"Not in file."`
+	}
+
+	dotenv := `# comment
+TEST_PLAIN=plain value
+TEST_COMMENT=value # comment
+export TEST_EXPORTED=exported
+TEST_SINGLE='$HOME "quoted" # no comment'
+TEST_DOUBLE="tab\there \$HOME \"quoted\"" # comment
+
+TEST_MULTI="line 1
+line 2"
+TAGGED = tagged
+TEST_FROM_FILE=fromDotEnv
+TEST_FROM_ENV=fromDotEnv
+`
+
+	expected := dotEnvCLI{
+		Plain:    "plain value",
+		Comment:  "value",
+		Exported: "exported",
+		Single:   `$HOME "quoted" # no comment`,
+		Double:   "tab\there $HOME \"quoted\"",
+		Multi:    "line 1\nline 2",
+		Tagged:   "tagged",
+		FromFile: "fromDotEnv",
+		FromEnv:  "fromDotEnv",
+	}
+
+	t.Run("file resolver", func(t *testing.T) {
+		path, cleanUpFile := writeFile(t, []byte(dotenv))
+		defer cleanUpFile()
+
+		c := dotEnvCLI{}
+		parser, err := kong.New(&c, king.DefaultOptions(king.Config{
+			Name:         "test",
+			ConfigPaths:  []string{path},
+			FileResolver: king.DotEnv,
+		})...)
+		require.NoError(t, err)
+
+		_, err = parser.Parse([]string{})
+		require.NoError(t, err)
+		assert.Equal(t, expected, c)
+	})
+
+	t.Run("precedence", func(t *testing.T) {
+		cleanup := tempEnv(envMap{
+			"TEST_FROM_ENV": "fromEnv",
+		})
+
+		defer cleanup()
+
+		path, cleanUpFile := writeFile(t, []byte(dotenv))
+		defer cleanUpFile()
+
+		config, cleanUpConfig := writeFile(t, []byte("from-file: fromFile\nnot-in-file: fromFile\nplain: fromFile\n"))
+		defer cleanUpConfig()
+
+		c := dotEnvCLI{}
+		parser, err := kong.New(&c, king.DefaultOptions(king.Config{
+			Name:        "test",
+			ConfigPaths: []string{config},
+			DotEnvFiles: []string{path, "/does/not/exist/.env"},
+		})...)
+		require.NoError(t, err)
+
+		ctx, err := parser.Parse([]string{})
+		require.NoError(t, err)
+
+		e := expected
+		e.FromEnv = "fromEnv"
+		e.NotInFile = "fromFile"
+		assert.Equal(t, e, c)
+
+		origins := king.Origins(ctx)
+		assert.Equal(t, king.Origin{Source: king.SourceDotEnv, Location: path}, origins["from-file"])
+		assert.Equal(t, king.Origin{Source: king.SourceFile, Location: config}, origins["not-in-file"])
+		assert.Equal(t, king.Origin{Source: king.SourceEnv, Location: "TEST_FROM_ENV"}, origins["from-env"])
+
+		files, err := king.EffectiveConfigFiles(ctx)
+		require.NoError(t, err)
+		require.Len(t, files, 3)
+		assert.Equal(t, king.ConfigFile{Path: "/does/not/exist/.env", Status: king.StatusNotFound}, files[2])
+	})
+
+	t.Run("no interpolation", func(t *testing.T) {
+		path, cleanUpFile := writeFile(t, []byte("TEST_SINGLE='${HOME}$$'\nTEST_DOUBLE=\"\\${HOME}\"\n"))
+		defer cleanUpFile()
+
+		for _, cfg := range []king.Config{
+			{Name: "test", ConfigPaths: []string{}, DotEnvFiles: []string{path}, Interpolate: true},
+			{Name: "test", ConfigPaths: []string{path}, FileResolver: king.DotEnv, Interpolate: true},
+		} {
+			c := dotEnvCLI{}
+			parser, err := kong.New(&c, king.DefaultOptions(cfg)...)
+			require.NoError(t, err)
+
+			_, err = parser.Parse([]string{})
+			require.NoError(t, err)
+			assert.Equal(t, "${HOME}$$", c.Single)
+			assert.Equal(t, "${HOME}", c.Double)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for content, msg := range map[string]string{
+			"TEST_PLAIN":                 "line 1: expected KEY=VALUE",
+			"# ok\nTEST-PLAIN=value":     `line 2: invalid key "TEST-PLAIN"`,
+			"TEST_DOUBLE=\"open\n\n":     "line 1: TEST_DOUBLE: missing closing quote",
+			"TEST_SINGLE='a\nb' c":       `line 2: TEST_SINGLE: unexpected "c" after quoted value`,
+			"A=1\nTEST_DOUBLE=\"\\q\"":   `line 2: TEST_DOUBLE: invalid escape sequence`,
+			"A='1\n2'\nTEST_PLAIN=x\n=y": "line 4: invalid key",
+		} {
+			path, cleanUpFile := writeFile(t, []byte(content))
+			defer cleanUpFile()
+
+			parser, err := kong.New(&dotEnvCLI{}, king.DefaultOptions(king.Config{
+				Name:        "test",
+				DotEnvFiles: []string{path},
+			})...)
+			require.NoError(t, err)
+
+			_, err = parser.Parse([]string{})
+			require.Error(t, err, content)
+			assert.Contains(t, err.Error(), msg)
+		}
+	})
+
+	t.Run("sample", func(t *testing.T) {
+		buf := &strings.Builder{}
+		parser, err := kong.New(&dotEnvCLI{}, king.DefaultOptions(king.Config{Name: "test"})...)
+		require.NoError(t, err)
+		require.NoError(t, king.WriteSampleConfig(buf, parser.Model, king.DotEnv))
+		assert.Contains(t, buf.String(), "# Plain.\n# flag: --plain, type: string\n# TEST_PLAIN=\n")
+	})
+
+	t.Run("sample round trip", func(t *testing.T) {
+		type sampleCLI struct {
+			Port     int           `help:"Port."`
+			Debug    bool          `help:"Debug."`
+			Verbose  int           `help:"Verbosity." type:"counter"`
+			Timeout  time.Duration `help:"Timeout." default:"5s"`
+			Name     string        `help:"Name." default:"a # b"`
+			Password string        `help:"Password." default:"s3cret" sensitive:""`
+		}
+
+		buf := &strings.Builder{}
+		parser, err := kong.New(&sampleCLI{}, king.DefaultOptions(king.Config{Name: "test"})...)
+		require.NoError(t, err)
+		require.NoError(t, king.WriteSampleConfig(buf, parser.Model, king.DotEnv))
+
+		path, cleanUpFile := writeFile(t, []byte(buf.String()))
+		defer cleanUpFile()
+
+		c := sampleCLI{}
+		parser, err = kong.New(&c, king.DefaultOptions(king.Config{
+			Name:        "test",
+			ConfigPaths: []string{},
+			DotEnvFiles: []string{path},
+		})...)
+		require.NoError(t, err)
+
+		_, err = parser.Parse([]string{})
+		require.NoError(t, err)
+		assert.Equal(t, sampleCLI{Timeout: 5 * time.Second, Name: "a # b", Password: "s3cret"}, c)
+	})
+}
+
+func TestKeyDirs(t *testing.T) {
+	type keyDirCLI struct {
+		Listen string `help:"Listen."`
+		Token  string `help:"Token."`
+		Server struct {
+			Workers int `help:"Workers."`
+		} `cmd:"" default:"1"`
+	}
+
+	dir := t.TempDir()
+	configMap := filepath.Join(dir, "config")
+	credentials := filepath.Join(dir, "credentials")
+
+	writeVersion := func(version, listen string) {
+		data := filepath.Join(configMap, version)
+		require.NoError(t, os.MkdirAll(data, 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(data, "listen"), []byte(listen+"\n"), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(data, "server.workers"), []byte("4\n"), 0o600))
+
+		// Kubernetes swaps the ..data link atomically.
+		require.NoError(t, os.Symlink(version, filepath.Join(configMap, "..data_tmp")))
+		require.NoError(t, os.Rename(filepath.Join(configMap, "..data_tmp"), filepath.Join(configMap, "..data")))
+	}
+
+	writeVersion("..2024_01_01", ":8080")
+
+	for _, key := range []string{"listen", "server.workers"} {
+		require.NoError(t, os.Symlink(filepath.Join("..data", key), filepath.Join(configMap, key)))
+	}
+
+	require.NoError(t, os.MkdirAll(credentials, 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(credentials, "TEST_TOKEN"), []byte("s3cret\n\n"), 0o600))
+
+	cleanup := tempEnv(envMap{
+		"CREDENTIALS_DIRECTORY": credentials,
+	})
+
+	defer cleanup()
+
+	c := keyDirCLI{}
+	parser, err := kong.New(&c, king.DefaultOptions(king.Config{
+		Name:        "test",
+		ConfigPaths: []string{},
+		KeyDirs:     []string{configMap, filepath.Join(dir, "missing")},
+		Credentials: true,
+	})...)
+	require.NoError(t, err)
+
+	ctx, err := parser.Parse([]string{})
+	require.NoError(t, err)
+	assert.Equal(t, ":8080", c.Listen)
+	assert.Equal(t, "s3cret", c.Token)
+	assert.Equal(t, 4, c.Server.Workers)
+
+	m := king.FlagMap(ctx)
+	assert.Equal(t, ":8080", m["listen"])
+	assert.Equal(t, "******", m["token"])
+
+	origins := king.Origins(ctx)
+	assert.Equal(t, king.Origin{Source: king.SourceDirectory, Location: configMap}, origins["listen"])
+	assert.Equal(t, king.Origin{Source: king.SourceDirectory, Location: credentials}, origins["token"])
+
+	files, err := king.EffectiveConfigFiles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []king.ConfigFile{
+		{Path: configMap, Status: king.StatusParsed, Keys: []string{"listen", "workers"}},
+		{Path: filepath.Join(dir, "missing"), Status: king.StatusNotFound},
+		{Path: credentials, Status: king.StatusParsed, Keys: []string{"token"}},
+	}, files)
+
+	writeVersion("..2024_01_02", ":9090")
+
+	c = keyDirCLI{}
+	_, err = parser.Parse([]string{})
+	require.NoError(t, err)
+	assert.Equal(t, ":9090", c.Listen)
+
+	// Values of key directories are raw, they are neither interpolated nor
+	// resolved by secret providers.
+	parser, err = kong.New(&c, king.DefaultOptions(king.Config{
+		Name:            "test",
+		ConfigPaths:     []string{},
+		Credentials:     true,
+		Interpolate:     true,
+		SecretProviders: king.DefaultSecretProviders(),
+	})...)
+	require.NoError(t, err)
+
+	for _, token := range []string{"pa$$word", "x${y", "env://HOME"} {
+		require.NoError(t, os.WriteFile(filepath.Join(credentials, "TEST_TOKEN"), []byte(token+"\n"), 0o600))
+
+		c = keyDirCLI{}
+		_, err = parser.Parse([]string{})
+		require.NoError(t, err, token)
+		assert.Equal(t, token, c.Token)
+	}
+}
+
+func TestINIAndPropertiesResolvers(t *testing.T) {
+	type dbFlags struct {
+		Host string `help:"Host."`
+		Port int    `help:"Port."`
+	}
+
+	type legacyCLI struct {
+		Name   string  `help:"Name."`
+		Quoted string  `help:"Quoted."`
+		DB     dbFlags `embed:"" prefix:"db-"`
+		Server struct {
+			Listen string `help:"Listen."`
+		} `cmd:"" default:"1"`
+	}
+
+	expected := legacyCLI{
+		Name:   "legacy app",
+		Quoted: "a ; b",
+		DB:     dbFlags{Host: "db.example.com", Port: 5432},
+	}
+	expected.Server.Listen = ":8080"
+
+	for _, tc := range []struct {
+		resolver king.FileResolver
+		content  string
+	}{
+		{
+			resolver: king.INI,
+			content: `; comment
+name = legacy app ; inline comment
+quoted = "a ; b"
+
+[db]
+host = db.example.com
+port: 5432
+
+[server]
+listen = ':8080'
+`,
+		},
+		{
+			resolver: king.Properties,
+			content: `# comment
+! comment
+name = legacy \
+       app
+quoted:a ; b
+db.host db.example.com
+db.port=5432
+server.listen=:8080
+`,
+		},
+	} {
+		t.Run(string(tc.resolver), func(t *testing.T) {
+			path, cleanUpFile := writeFile(t, []byte(tc.content))
+			defer cleanUpFile()
+
+			c := legacyCLI{}
+			parser, err := kong.New(&c, king.DefaultOptions(king.Config{
+				Name:         "test",
+				ConfigPaths:  []string{path},
+				FileResolver: tc.resolver,
+			})...)
+			require.NoError(t, err)
+
+			_, err = parser.Parse([]string{})
+			require.NoError(t, err)
+			assert.Equal(t, expected, c)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		for _, tc := range []struct {
+			resolver king.FileResolver
+			content  string
+			msg      string
+		}{
+			{king.INI, "[server", "line 1: missing ] in section header"},
+			{king.INI, "name", "line 1: expected key = value"},
+			{king.INI, "\nname = \"open", "line 2: name: missing closing quote"},
+			{king.Properties, "name=\\u00zz", `line 1: name: invalid unicode escape`},
+		} {
+			path, cleanUpFile := writeFile(t, []byte(tc.content))
+			defer cleanUpFile()
+
+			parser, err := kong.New(&legacyCLI{}, king.DefaultOptions(king.Config{
+				Name:         "test",
+				ConfigPaths:  []string{path},
+				FileResolver: tc.resolver,
+			})...)
+			require.NoError(t, err)
+
+			_, err = parser.Parse([]string{})
+			require.Error(t, err, tc.content)
+			assert.Contains(t, err.Error(), tc.msg)
+		}
+	})
+
+	t.Run("section value", func(t *testing.T) {
+		type listenCLI struct {
+			Listen        string `help:"Listen."`
+			ListenAddress string `help:"Listen address."`
+		}
+
+		for _, tc := range []struct {
+			resolver king.FileResolver
+			content  string
+		}{
+			{king.Properties, "listen.address=x\nlisten=y"},
+			{king.Properties, "listen=y\nlisten.address=x"},
+			{king.INI, "listen = y\n[listen]\naddress = x"},
+		} {
+			path, cleanUpFile := writeFile(t, []byte(tc.content))
+			defer cleanUpFile()
+
+			c := listenCLI{}
+			parser, err := kong.New(&c, king.DefaultOptions(king.Config{
+				Name:         "test",
+				ConfigPaths:  []string{path},
+				FileResolver: tc.resolver,
+			})...)
+			require.NoError(t, err)
+
+			_, err = parser.Parse([]string{})
+			require.NoError(t, err, tc.content)
+			assert.Equal(t, listenCLI{Listen: "y", ListenAddress: "x"}, c, tc.content)
+		}
+	})
+}
+
+func TestOverlays(t *testing.T) {
+	dir := t.TempDir()
+	confd := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.Mkdir(confd, 0o750))
+
+	for name, content := range map[string]string{
+		"config.yaml":              "from-config: base\nother: base\n",
+		"config.staging.yaml":      "from-config: staging\n",
+		"conf.d/10-a.yaml":         "# base fragment\n",
+		"conf.d/10-a.staging.yaml": "other: staging-fragment\n",
+		"conf.d/10-a.prod.yaml":    "other: prod-fragment\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	config := filepath.Join(dir, "config.yaml")
+
+	newParser := func(t *testing.T, c *configCLI) (*kong.Kong, *strings.Builder) {
+		t.Helper()
+
+		return newTestParser(t, king.Config{Name: "test", ConfigPaths: []string{config, confd}, Overlays: true}, c)
+	}
+
+	t.Run("no environment", func(t *testing.T) {
+		c := configCLI{}
+		parser, _ := newParser(t, &c)
+
+		ctx, err := parser.Parse([]string{})
+		require.NoError(t, err)
+		assert.Equal(t, configCLI{FromConfig: "base", Other: "base"}, c)
+
+		files, err := king.EffectiveConfigFiles(ctx)
+		require.NoError(t, err)
+		require.Len(t, files, 2)
+	})
+
+	t.Run("flag", func(t *testing.T) {
+		c := configCLI{}
+		parser, buf := newParser(t, &c)
+
+		ctx, err := parser.Parse([]string{"--env", "staging"})
+		require.NoError(t, err)
+		assert.Equal(t, configCLI{FromConfig: "staging", Other: "staging-fragment"}, c)
+
+		origins := king.Origins(ctx)
+		assert.Equal(t, king.Origin{Source: king.SourceFile, Location: filepath.Join(dir, "config.staging.yaml"), Overlay: "staging"}, origins["from-config"])
+		assert.Equal(t, "file:"+filepath.Join(dir, "config.staging.yaml")+" (overlay staging)", origins["from-config"].String())
+
+		files, err := king.EffectiveConfigFiles(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []king.ConfigFile{
+			{Path: config, Status: king.StatusParsed, Keys: []string{"from-config", "other"}},
+			{Path: filepath.Join(dir, "config.staging.yaml"), Status: king.StatusParsed, Overlay: "staging", Keys: []string{"from-config"}},
+			{Path: filepath.Join(confd, "10-a.yaml"), Status: king.StatusParsed},
+			{Path: filepath.Join(confd, "10-a.staging.yaml"), Status: king.StatusParsed, Overlay: "staging", Keys: []string{"other"}},
+		}, files)
+
+		_, err = parser.Parse([]string{"--env", "staging", "--show-config"})
+		require.NoError(t, err)
+		assert.Regexp(t, `config.yaml +parsed +base +from-config, other\n`, buf.String())
+		assert.Regexp(t, `config.staging.yaml +parsed +overlay staging +from-config\n`, buf.String())
+	})
+
+	t.Run("env", func(t *testing.T) {
+		cleanup := tempEnv(envMap{
+			"TEST_ENV": "prod",
+		})
+
+		defer cleanup()
+
+		c := configCLI{}
+		parser, _ := newParser(t, &c)
+
+		ctx, err := parser.Parse([]string{})
+		require.NoError(t, err)
+		assert.Equal(t, configCLI{FromConfig: "base", Other: "prod-fragment"}, c)
+
+		files, err := king.EffectiveConfigFiles(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, king.ConfigFile{Path: filepath.Join(dir, "config.prod.yaml"), Status: king.StatusNotFound, Overlay: "prod"}, files[1])
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		parser, _ := newParser(t, &configCLI{})
+
+		_, err := parser.Parse([]string{"--env", "../etc"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid environment "../etc"`)
+	})
+}
+
+func TestProfiles(t *testing.T) {
+	type profileCLI struct {
+		Listen string `help:"Listen."`
+		Debug  bool   `help:"Debug."`
+		Level  string `help:"Level." default:"info"`
+		Server struct {
+			Workers int `help:"Workers."`
+		} `cmd:"" default:"1"`
+	}
+
+	files := map[king.FileResolver]string{
+		king.YAML: `listen: ":8080"
+server:
+  workers: 2
+profiles:
+  dev:
+    debug: true
+    level: debug
+  prod:
+    inherits: dev
+    debug: false
+    server:
+      workers: 8
+  loop-a:
+    inherits: loop-b
+  loop-b:
+    inherits: loop-a
+  orphan:
+    inherits: missing
+`,
+		king.TOML: `listen = ":8080"
+
+[server]
+workers = 2
+
+[profiles.dev]
+debug = true
+level = "debug"
+
+[profiles.prod]
+inherits = "dev"
+debug = false
+
+[profiles.prod.server]
+workers = 8
+
+[profiles.loop-a]
+inherits = "loop-b"
+
+[profiles.loop-b]
+inherits = "loop-a"
+
+[profiles.orphan]
+inherits = "missing"
+`,
+	}
+
+	for f, content := range files {
+		t.Run(string(f), func(t *testing.T) {
+			path, cleanUpFile := writeFile(t, []byte(content))
+			defer cleanUpFile()
+
+			parse := func(args ...string) (profileCLI, error) {
+				c := profileCLI{}
+				parser, _ := newTestParser(t, king.Config{Name: "test", ConfigPaths: []string{path}, FileResolver: f, Profiles: true}, &c)
+
+				_, err := parser.Parse(args)
+
+				return c, err
+			}
+
+			c, err := parse()
+			require.NoError(t, err)
+			assert.Equal(t, ":8080", c.Listen)
+			assert.Equal(t, "info", c.Level)
+			assert.Equal(t, 2, c.Server.Workers)
+			assert.False(t, c.Debug)
+
+			c, err = parse("--profile", "dev")
+			require.NoError(t, err)
+			assert.True(t, c.Debug)
+			assert.Equal(t, "debug", c.Level)
+			assert.Equal(t, ":8080", c.Listen)
+
+			cleanup := tempEnv(envMap{
+				"TEST_PROFILE": "prod",
+			})
+
+			defer cleanup()
+
+			c, err = parse()
+			require.NoError(t, err)
+			assert.False(t, c.Debug)
+			assert.Equal(t, "debug", c.Level)
+			assert.Equal(t, 8, c.Server.Workers)
+
+			_, err = parse("--profile", "unknown")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), `unknown profile "unknown"`)
+
+			_, err = parse("--profile", "loop-a")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "profile loop-a: inheritance cycle loop-a -> loop-b -> loop-a")
+
+			_, err = parse("--profile", "orphan")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), `profile orphan: unknown profile "missing"`)
+		})
+	}
+
+	t.Run("schema", func(t *testing.T) {
+		parser, err := kong.New(&profileCLI{}, king.DefaultOptions(king.Config{Name: "test", Profiles: true})...)
+		require.NoError(t, err)
+
+		s := king.JSONSchema(parser.Model)
+		require.Contains(t, s.Properties, "profiles")
+		profile, ok := s.Properties["profiles"].AdditionalProperties.(*king.Schema)
+		require.True(t, ok)
+		assert.Contains(t, profile.Properties, "inherits")
+		assert.Contains(t, profile.Properties, "debug")
+		assert.NotContains(t, profile.Properties, "profile")
+	})
+}
+
+func TestIncludes(t *testing.T) {
+	type includeCLI struct {
+		Listen string `help:"Listen."`
+		Debug  bool   `help:"Debug."`
+		Level  string `help:"Level." default:"info"`
+		Server struct {
+			Workers int `help:"Workers."`
+		} `cmd:"" default:"1"`
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.yaml":        "listen: \":8080\"\nlevel: warn\nserver:\n  workers: 2\n",
+		"shared/team.yaml": "extends: ../base.yaml\ndebug: true\nserver:\n  workers: 4\n",
+		"service.yaml":     "include:\n  - shared/team.yaml\nlevel: debug\n",
+		"cycle-a.yaml":     "include: cycle-b.yaml\n",
+		"cycle-b.yaml":     "include: ./cycle-a.yaml\n",
+		"missing.yaml":     "extends: shared/missing.yaml\n",
+		"invalid.yaml":     "extends: [1]\n",
+	}
+
+	for i := 0; i <= 10; i++ {
+		files[fmt.Sprintf("deep-%d.yaml", i)] = fmt.Sprintf("extends: deep-%d.yaml\n", i+1)
+	}
+
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	parse := func(name string) (includeCLI, error) {
+		c := includeCLI{}
+		parser, _ := newTestParser(t, king.Config{Name: "test", ConfigPaths: []string{filepath.Join(dir, name)}, Includes: true}, &c)
+
+		_, err := parser.Parse([]string{})
+
+		return c, err
+	}
+
+	c, err := parse("service.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, ":8080", c.Listen)
+	assert.True(t, c.Debug)
+	assert.Equal(t, "debug", c.Level)
+	assert.Equal(t, 4, c.Server.Workers)
+
+	_, err = parse("cycle-a.yaml")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("include cycle %[1]s/cycle-a.yaml -> %[1]s/cycle-b.yaml -> %[1]s/cycle-a.yaml", dir))
+
+	_, err = parse("missing.yaml")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("include chain %[1]s/missing.yaml -> %[1]s/shared/missing.yaml: ", dir))
+
+	_, err = parse("invalid.yaml")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "extends: expected a path, got 1")
+
+	_, err = parse("deep-0.yaml")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "more than 10 levels")
+
+	t.Run("disabled", func(t *testing.T) {
+		c := includeCLI{}
+		parser, err := kong.New(&c, king.DefaultOptions(king.Config{
+			Name:        "test",
+			ConfigPaths: []string{filepath.Join(dir, "service.yaml")},
+		})...)
+		require.NoError(t, err)
+
+		_, err = parser.Parse([]string{})
+		require.NoError(t, err)
+		assert.Equal(t, "debug", c.Level)
+		assert.Empty(t, c.Listen)
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		parser, err := kong.New(&includeCLI{}, king.DefaultOptions(king.Config{Name: "test", Includes: true})...)
+		require.NoError(t, err)
+
+		s := king.JSONSchema(parser.Model)
+		assert.Contains(t, s.Properties, "extends")
+		assert.Contains(t, s.Properties, "include")
+	})
+}
+
+func TestMergeStrategies(t *testing.T) {
+	type mergeCLI struct {
+		Labels   map[string]string         `help:"Labels." merge:"deep"`
+		Limits   map[string]map[string]int `help:"Limits." merge:"deep"`
+		Peers    []string                  `help:"Peers." merge:"append"`
+		Replaced []string                  `help:"Replaced."`
+	}
+
+	system, cleanUpSystem := writeFile(t, []byte(`labels:
+  team: core
+  env: prod
+limits:
+  cpu:
+    soft: 1
+    hard: 2
+peers: [a, b]
+replaced: [a, b]
+`))
+	defer cleanUpSystem()
+
+	user, cleanUpUser := writeFile(t, []byte(`labels:
+  env: dev
+limits:
+  cpu:
+    hard: 4
+peers: [c]
+replaced: [c]
+`))
+	defer cleanUpUser()
+
+	parse := func(cli any, args ...string) error {
+		parser, _ := newTestParser(t, king.Config{Name: "test", ConfigPaths: []string{system, user}}, cli)
+
+		_, err := parser.Parse(args)
+
+		return err
+	}
+
+	c := mergeCLI{}
+	require.NoError(t, parse(&c))
+	assert.Equal(t, map[string]string{"team": "core", "env": "dev"}, c.Labels)
+	assert.Equal(t, map[string]map[string]int{"cpu": {"soft": 1, "hard": 4}}, c.Limits)
+	assert.Equal(t, []string{"a", "b", "c"}, c.Peers)
+	assert.Equal(t, []string{"c"}, c.Replaced)
+
+	cleanup := tempEnv(envMap{
+		"TEST_LABELS": "region=eu",
+		"TEST_PEERS":  "d,e",
+	})
+
+	defer cleanup()
+
+	c = mergeCLI{}
+	require.NoError(t, parse(&c, "--labels", "env=test", "--peers", "f"))
+	assert.Equal(t, map[string]string{"team": "core", "env": "test", "region": "eu"}, c.Labels)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f"}, c.Peers)
+
+	invalid := struct {
+		Name string `merge:"append"`
+	}{}
+	err := parse(&invalid)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `merge strategy "append" is not supported for string`)
+
+	unknown := struct {
+		Peers []string `merge:"union"`
+	}{}
+	err = parse(&unknown)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown merge strategy "union"`)
+
+	secrets, cleanUpSecrets := writeFile(t, []byte("peers: [count://peer]\n"))
+	defer cleanUpSecrets()
+
+	calls := 0
+	parser, err := kong.New(&mergeCLI{}, king.DefaultOptions(king.Config{
+		Name:        "test",
+		ConfigPaths: []string{system, secrets},
+		SecretProviders: map[string]king.SecretProvider{
+			"count": king.SecretProviderFunc(func(ref string) (string, error) {
+				calls++
+				return ref, nil
+			}),
+		},
+	})...)
+	require.NoError(t, err)
+
+	_, err = parser.Parse([]string{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestLayers(t *testing.T) {
+	type layerCLI struct {
+		ShowConfig king.ShowConfig `help:"Show configuration files."`
+		FromConfig string          `help:"From config."`
+		Other      string          `help:"Other value." env:"OTHER"`
+	}
+
+	config, cleanUpFile := writeFile(t, []byte("from-config: fromConfig\n"))
+	defer cleanUpFile()
+
+	cleanup := tempEnv(envMap{
+		"TEST_FROM_CONFIG": "fromEnv",
+		"OTHER":            "fromEnv",
+	})
+
+	defer cleanup()
+
+	newParser := func(t *testing.T, layers []king.Layer, cli any) (*kong.Kong, *strings.Builder) {
+		t.Helper()
+
+		return newTestParser(t, king.Config{Name: "test", ConfigPaths: []string{config}, Layers: layers}, cli)
+	}
+
+	t.Run("default", func(t *testing.T) {
+		c := layerCLI{}
+		parser, buf := newParser(t, nil, &c)
+		_, err := parser.Parse([]string{})
+		require.NoError(t, err)
+		assert.Equal(t, "fromEnv", c.FromConfig)
+		assert.Equal(t, "fromEnv", c.Other)
+
+		_, err = parser.Parse([]string{"--show-config"})
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "Precedence: flags > env > dotenv > secrets > file\n")
+	})
+
+	t.Run("file before env", func(t *testing.T) {
+		c := layerCLI{}
+		parser, buf := newParser(t, []king.Layer{king.LayerFile, king.LayerEnv}, &c)
+		ctx, err := parser.Parse([]string{})
+		require.NoError(t, err)
+		assert.Equal(t, "fromConfig", c.FromConfig)
+		assert.Equal(t, king.Origin{Source: king.SourceFile, Location: config}, king.Origins(ctx)["from-config"])
+
+		_, err = parser.Parse([]string{"--show-config"})
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "Precedence: flags > file > env\n")
+	})
+
+	t.Run("env tags", func(t *testing.T) {
+		other, cleanUpOther := writeFile(t, []byte("other: fromFile\n"))
+		defer cleanUpOther()
+
+		for _, tc := range []struct {
+			layers []king.Layer
+			want   string
+			origin king.Origin
+		}{
+			{nil, "fromEnv", king.Origin{Source: king.SourceEnv, Location: "OTHER"}},
+			{[]king.Layer{king.LayerFile, king.LayerEnv}, "fromFile", king.Origin{Source: king.SourceFile, Location: other}},
+		} {
+			c := layerCLI{}
+			parser, err := kong.New(&c, king.DefaultOptions(king.Config{
+				Name:        "test",
+				ConfigPaths: []string{other},
+				Layers:      tc.layers,
+			})...)
+			require.NoError(t, err)
+
+			ctx, err := parser.Parse([]string{})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, c.Other)
+			assert.Equal(t, tc.origin, king.Origins(ctx)["other"])
+		}
+	})
+
+	t.Run("env disabled", func(t *testing.T) {
+		c := layerCLI{}
+		parser, buf := newParser(t, []king.Layer{king.LayerFile}, &c)
+		_, err := parser.Parse([]string{})
+		require.NoError(t, err)
+		assert.Equal(t, "fromConfig", c.FromConfig)
+		assert.Empty(t, c.Other)
+
+		_, err = parser.Parse([]string{"--help"})
+		require.NoError(t, err)
+		assert.NotContains(t, buf.String(), "$")
+
+		docs := struct {
+			layerCLI
+			EnvHelp king.EnvHelpFlag `help:"Show environment variables."`
+			Docs    king.DocsFlag    `help:"Print the documentation."`
+		}{}
+		parser, buf = newParser(t, []king.Layer{king.LayerFile}, &docs)
+
+		for _, args := range [][]string{{"--env-help"}, {"--docs=markdown"}, {"--docs=man"}} {
+			buf.Reset()
+			_, err = parser.Parse(args)
+			require.NoError(t, err)
+			assert.NotContains(t, buf.String(), "TEST_FROM_CONFIG", args)
+			assert.NotContains(t, buf.String(), "Environment", args)
+		}
+	})
+
+	t.Run("file disabled", func(t *testing.T) {
+		c := layerCLI{}
+		parser, _ := newParser(t, []king.Layer{king.LayerEnv}, &c)
+		ctx, err := parser.Parse([]string{})
+		require.NoError(t, err)
+		assert.Equal(t, "fromEnv", c.FromConfig)
+
+		files, err := king.EffectiveConfigFiles(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, files)
+
+		parser, err = kong.New(&layerCLI{}, king.DefaultOptions(king.Config{
+			Name:       "test",
+			ConfigMode: king.ConfigFlagReplace,
+			Overlays:   true,
+			Profiles:   true,
+			Layers:     []king.Layer{king.LayerEnv},
+		})...)
+		require.NoError(t, err)
+
+		for _, flag := range []string{"--config=/does/not/exist.yaml", "--env=prod", "--profile=dev"} {
+			_, err = parser.Parse([]string{flag})
+			require.Error(t, err, flag)
+			assert.Contains(t, err.Error(), "unknown flag", flag)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for layer, msg := range map[king.Layer]string{
+			"cli":         `unknown layer "cli"`,
+			king.LayerEnv: `duplicate layer "env"`,
+		} {
+			_, err := kong.New(&layerCLI{}, king.DefaultOptions(king.Config{
+				Name:   "test",
+				Layers: []king.Layer{king.LayerEnv, layer},
+			})...)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), msg)
+		}
+	})
+}
+
+func TestPolicy(t *testing.T) {
+	type policyCLI struct {
+		ShowConfig king.ShowConfig `help:"Show configuration files."`
+		FromConfig string          `help:"From config."`
+		Other      string          `help:"Other value."`
+		Telemetry  bool            `help:"Send telemetry."`
+	}
+
+	config, cleanUpConfig := writeFile(t, []byte("from-config: fromConfig\nother: fromConfig\ntelemetry: true\n"))
+	defer cleanUpConfig()
+
+	policy, cleanUpPolicy := writeFile(t, []byte("telemetry: false\nother: fromPolicy\n"))
+	defer cleanUpPolicy()
+
+	newParser := func(t *testing.T, e king.Enforcement, cli any, configs ...string) (*kong.Kong, *strings.Builder) {
+		t.Helper()
+
+		if len(configs) == 0 {
+			configs = []string{config}
+		}
+
+		return newTestParser(t, king.Config{
+			Name:              "test",
+			ConfigPaths:       configs,
+			PolicyFiles:       []string{policy, filepath.Join(t.TempDir(), "missing.yaml")},
+			PolicyEnforcement: e,
+		}, cli)
+	}
+
+	t.Run("warn", func(t *testing.T) {
+		c := policyCLI{}
+		parser, buf := newParser(t, king.EnforceWarn, &c)
+		ctx, err := parser.Parse([]string{"--other", "fromFlag"})
+		require.NoError(t, err)
+		assert.Equal(t, policyCLI{FromConfig: "fromConfig", Other: "fromPolicy", Telemetry: false}, c)
+		assert.Contains(t, buf.String(), "warning: --other is locked by policy "+policy+"\n")
+		assert.Contains(t, buf.String(), "warning: --telemetry is locked by policy "+policy+"\n")
+
+		origins := king.Origins(ctx)
+		assert.Equal(t, king.Origin{Source: king.SourcePolicy, Location: policy}, origins["other"])
+		assert.Equal(t, king.Origin{Source: king.SourcePolicy, Location: policy}, origins["telemetry"])
+		assert.Equal(t, king.Origin{Source: king.SourceFile, Location: config}, origins["from-config"])
+	})
+
+	t.Run("same value", func(t *testing.T) {
+		user, cleanUpUser := writeFile(t, []byte("from-config: fromUser\ntelemetry: false\n"))
+		defer cleanUpUser()
+
+		c := policyCLI{}
+		parser, _ := newParser(t, king.EnforceError, &c, user)
+		_, err := parser.Parse([]string{"--other", "fromPolicy"})
+		require.NoError(t, err)
+		assert.Equal(t, policyCLI{FromConfig: "fromUser", Other: "fromPolicy"}, c)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		c := policyCLI{}
+		parser, _ := newParser(t, king.EnforceError, &c)
+		_, err := parser.Parse([]string{"--other", "fromFlag"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "is locked by policy "+policy)
+	})
+
+	t.Run("show config and help", func(t *testing.T) {
+		parser, buf := newParser(t, king.EnforceWarn, &policyCLI{})
+		_, err := parser.Parse([]string{"--show-config"})
+		require.NoError(t, err)
+		assert.Regexp(t, regexp.QuoteMeta(policy)+` +parsed +policy \(locked\) +(telemetry, other|other, telemetry)\n`, buf.String())
+		assert.Contains(t, buf.String(), "Precedence: policy > flags > env > dotenv > secrets > file\n")
+
+		buf.Reset()
+
+		_, err = parser.Parse([]string{"--help"})
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "Other value (locked by policy) ($TEST_OTHER).")
+		assert.Contains(t, buf.String(), "From config ($TEST_FROM_CONFIG).")
+	})
+
+	t.Run("resolved once", func(t *testing.T) {
+		secrets, cleanUpSecrets := writeFile(t, []byte("other: count://fromConfig\n"))
+		defer cleanUpSecrets()
+
+		locked, cleanUpLocked := writeFile(t, []byte("other: count://fromPolicy\n"))
+		defer cleanUpLocked()
+
+		calls := map[string]int{}
+		c := policyCLI{}
+		parser, _ := newTestParser(t, king.Config{
+			Name:              "test",
+			ConfigPaths:       []string{secrets},
+			PolicyFiles:       []string{locked},
+			PolicyEnforcement: king.EnforceWarn,
+			SecretProviders: map[string]king.SecretProvider{
+				"count": king.SecretProviderFunc(func(ref string) (string, error) {
+					calls[ref]++
+					return ref, nil
+				}),
+			},
+		}, &c)
+
+		_, err := parser.Parse([]string{})
+		require.NoError(t, err)
+		assert.Equal(t, "fromPolicy", c.Other)
+		assert.Equal(t, map[string]int{"fromConfig": 1, "fromPolicy": 1}, calls)
+	})
+}
+
+func TestSources(t *testing.T) {
+	type sourcesCLI struct {
+		Token    string `help:"Token." sources:"env,file"`
+		Password string `help:"Password." sensitive:""`
+		Name     string `help:"Name."`
+	}
+
+	config, cleanUpFile := writeFile(t, []byte("token: fromConfig\n"))
+	defer cleanUpFile()
+
+	parse := func(e king.Enforcement, cli any, args ...string) (string, error) {
+		parser, buf := newTestParser(t, king.Config{Name: "test", ConfigPaths: []string{config}, SourceEnforcement: e}, cli)
+
+		_, err := parser.Parse(args)
+
+		return buf.String(), err
+	}
+
+	c := sourcesCLI{}
+	out, err := parse(king.EnforceError, &c)
+	require.NoError(t, err)
+	assert.Equal(t, "fromConfig", c.Token)
+	assert.Empty(t, out)
+
+	cleanup := tempEnv(envMap{
+		"TEST_TOKEN": "fromEnv",
+	})
+
+	defer cleanup()
+
+	c = sourcesCLI{}
+	_, err = parse(king.EnforceError, &c)
+	require.NoError(t, err)
+	assert.Equal(t, "fromEnv", c.Token)
+
+	_, err = parse(king.EnforceError, &sourcesCLI{}, "--token", "fromFlag")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--token must not be set by flag (allowed sources: env, file)")
+
+	c = sourcesCLI{}
+	out, err = parse(king.EnforceWarn, &c, "--token", "fromFlag", "--password", "secret", "--name", "name")
+	require.NoError(t, err)
+	assert.Equal(t, "fromFlag", c.Token)
+	assert.Contains(t, out, "warning: --token must not be set by flag (allowed sources: env, file)\n")
+	assert.Contains(t, out, "warning: --password is sensitive and should not be set on the command line\n")
+	assert.NotContains(t, out, "--name")
+
+	_, err = parse(king.EnforceWarn, &struct {
+		Token string `sources:"env,argv"`
+	}{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown source "argv"`)
+}
+
+func TestEmbeddedConfig(t *testing.T) {
+	embedded := fstest.MapFS{
+		"defaults/config.yaml": &fstest.MapFile{Data: []byte("from-config: fromEmbedded\nother: fromEmbedded\n")},
+	}
+
+	config, cleanUpFile := writeFile(t, []byte("other: fromConfig\n"))
+	defer cleanUpFile()
+
+	c := configCLI{}
+	parser, buf := newTestParser(t, king.Config{
+		Name:               "test",
+		ConfigPaths:        []string{config},
+		EmbeddedConfig:     embedded,
+		EmbeddedConfigPath: "defaults/config.yaml",
+	}, &c)
+
+	ctx, err := parser.Parse([]string{})
+	require.NoError(t, err)
+	assert.Equal(t, configCLI{FromConfig: "fromEmbedded", Other: "fromConfig"}, c)
+
+	origins := king.Origins(ctx)
+	assert.Equal(t, king.Origin{Source: king.SourceEmbedded, Location: "defaults/config.yaml"}, origins["from-config"])
+	assert.Equal(t, "embedded:defaults/config.yaml", origins["from-config"].String())
+
+	files, err := king.EffectiveConfigFiles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []king.ConfigFile{
+		{Path: "defaults/config.yaml", Status: king.StatusParsed, Embedded: true, Keys: []string{"from-config", "other"}},
+		{Path: config, Status: king.StatusParsed, Keys: []string{"other"}},
+	}, files)
+
+	_, err = parser.Parse([]string{"--show-config"})
+	require.NoError(t, err)
+	assert.Regexp(t, `defaults/config.yaml +parsed +embedded +from-config, other\n`, buf.String())
+
+	t.Run("missing", func(t *testing.T) {
+		parser, err := kong.New(&configCLI{}, king.DefaultOptions(king.Config{
+			Name:               "test",
+			EmbeddedConfig:     embedded,
+			EmbeddedConfigPath: "missing.yaml",
+		})...)
+		require.NoError(t, err)
+
+		_, err = parser.Parse([]string{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "missing.yaml")
+	})
+}
+
+func TestKeyNormalisation(t *testing.T) {
+	type dbFlags struct {
+		MaxConns int `help:"Max connections."`
+	}
+
+	type keysCLI struct {
+		ListenAddress string            `help:"Listen address."`
+		HTTPPort      int               `help:"HTTP port."`
+		Timeout       string            `help:"Timeout." config:"request_timeout, oldTimeout"`
+		Labels        map[string]string `help:"Labels."`
+		DB            dbFlags           `embed:"" prefix:"db-"`
+	}
+
+	for _, tc := range []struct {
+		name    string
+		content string
+		want    keysCLI
+		err     string
+	}{
+		{
+			name:    "kebab",
+			content: "listen-address: :80\nhttp-port: 8080\ntimeout: 1s\nlabels:\n  teamName: core\n",
+			want:    keysCLI{ListenAddress: ":80", HTTPPort: 8080, Timeout: "1s", Labels: map[string]string{"teamName": "core"}},
+		},
+		{
+			name:    "snake",
+			content: "listen_address: :80\nhttp_port: 8080\nrequest_timeout: 2s\ndb:\n  max_conns: 5\n",
+			want:    keysCLI{ListenAddress: ":80", HTTPPort: 8080, Timeout: "2s", DB: dbFlags{MaxConns: 5}},
+		},
+		{
+			name:    "camel",
+			content: "listenAddress: :80\nhttpPort: 8080\noldTimeout: 3s\ndbMaxConns: 6\n",
+			want:    keysCLI{ListenAddress: ":80", HTTPPort: 8080, Timeout: "3s", DB: dbFlags{MaxConns: 6}},
+		},
+		{
+			name:    "ambiguous",
+			content: "listen_address: :80\nlistenAddress: :81\n",
+			err:     "ambiguous keys listenAddress, listen_address",
+		},
+		{
+			name:    "ambiguous alias",
+			content: "timeout: 1s\nrequest_timeout: 2s\n",
+			err:     "ambiguous keys request_timeout, timeout",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path, cleanUpFile := writeFile(t, []byte(tc.content))
+			defer cleanUpFile()
+
+			c := keysCLI{}
+			parser, err := kong.New(&c, king.DefaultOptions(king.Config{
+				Name:        "test",
+				ConfigPaths: []string{path},
+			})...)
+			require.NoError(t, err)
+
+			_, err = parser.Parse([]string{})
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, c)
+		})
+	}
+
+	t.Run("profile override", func(t *testing.T) {
+		path, cleanUpFile := writeFile(t, []byte("listen_address: a\nprofiles:\n  dev:\n    listen-address: b\n"))
+		defer cleanUpFile()
+
+		c := keysCLI{}
+		parser, err := kong.New(&c, king.DefaultOptions(king.Config{
+			Name:        "test",
+			ConfigPaths: []string{path},
+			Profiles:    true,
+		})...)
+		require.NoError(t, err)
+
+		_, err = parser.Parse([]string{"--profile", "dev"})
+		require.NoError(t, err)
+		assert.Equal(t, "b", c.ListenAddress)
+	})
+
+	t.Run("include override", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "base.yaml"), []byte("listen-address: a\nlabels:\n  team: core\n"), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("include: base.yaml\nlisten_address: b\n"), 0o600))
+
+		c := keysCLI{}
+		parser, err := kong.New(&c, king.DefaultOptions(king.Config{
+			Name:        "test",
+			ConfigPaths: []string{filepath.Join(dir, "config.yaml")},
+			Includes:    true,
+		})...)
+		require.NoError(t, err)
+
+		_, err = parser.Parse([]string{})
+		require.NoError(t, err)
+		assert.Equal(t, "b", c.ListenAddress)
+		assert.Equal(t, map[string]string{"team": "core"}, c.Labels)
+	})
+}
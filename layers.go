@@ -0,0 +1,98 @@
+package king
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+const layersKey = "king_layers"
+
+// Layer is a source of flag values below the command line.
+type Layer string
+
+// All layers.
+const (
+	// LayerEnv are the environment variables of EnvResolver and the env
+	// tags of flags.
+	LayerEnv Layer = "env"
+	// LayerDotEnv are the files of Config.DotEnvFiles.
+	LayerDotEnv Layer = "dotenv"
+	// LayerSecrets are the directories of Config.KeyDirs and the systemd
+	// credentials (Config.Credentials).
+	LayerSecrets Layer = "secrets"
+	// LayerFile are the configuration files.
+	LayerFile Layer = "file"
+)
+
+// DefaultLayers returns the layers in their default order of precedence,
+// from the most to the least important.
+func DefaultLayers() []Layer {
+	return []Layer{LayerEnv, LayerDotEnv, LayerSecrets, LayerFile}
+}
+
+// validateLayers returns an error if layers contains an unknown or
+// duplicate layer.
+func validateLayers(layers []Layer) error {
+	seen := map[Layer]bool{}
+
+	for _, l := range layers {
+		if !slices.Contains(DefaultLayers(), l) {
+			return fmt.Errorf("unknown layer %q", l)
+		}
+
+		if seen[l] {
+			return fmt.Errorf("duplicate layer %q", l)
+		}
+
+		seen[l] = true
+	}
+
+	return nil
+}
+
+// disableEnvs removes the environment variables of all flags, it is used if
+// LayerEnv is disabled.
+func disableEnvs(k *kong.Kong) error {
+	for _, f := range modelFlags(k.Model.Node) {
+		f.Envs = nil
+	}
+
+	return nil
+}
+
+// hasLayer returns true if layer is enabled in vars. Applications that are
+// not configured by king have all layers.
+func hasLayer(vars kong.Vars, layer Layer) bool {
+	order, ok := vars[layersKey]
+	if !ok {
+		return true
+	}
+
+	return slices.Contains(strings.Split(order, ","), string(layer))
+}
+
+// precedence returns the sources of flag values, from the most to the
+// least important.
+func (c Config) precedence() string {
+	s := []string{"flags"}
+	if len(c.PolicyFiles) > 0 {
+		s = []string{"policy", "flags"}
+	}
+
+	for _, l := range c.Layers {
+		s = append(s, string(l))
+	}
+
+	return strings.Join(s, ",")
+}
+
+// writePrecedence writes the effective order of precedence of vars.
+func writePrecedence(w io.Writer, vars kong.Vars) {
+	if order, ok := vars[layersKey]; ok {
+		fmt.Fprintf(w, "Precedence: %s\n", strings.ReplaceAll(order, ",", " > "))
+	}
+}
@@ -0,0 +1,658 @@
+package king
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/kong"
+)
+
+const (
+	configEnvKey = "king_config_env"
+	stdinPath    = "-"
+)
+
+// ConfigMode defines if and how configuration files given on the command
+// line are used.
+type ConfigMode int
+
+// All ConfigModes.
+const (
+	// NoConfigFlag does not add a --config flag.
+	NoConfigFlag ConfigMode = iota
+	// ConfigFlagReplace adds a --config flag. The given files replace
+	// Config.ConfigPaths.
+	ConfigFlagReplace
+	// ConfigFlagPrepend adds a --config flag. The given files are read in
+	// addition to Config.ConfigPaths and take precedence over them.
+	ConfigFlagPrepend
+)
+
+// ConfigFlag is a repeatable flag with configuration files that are read
+// instead of or in addition to Config.ConfigPaths (see ConfigMode). The
+// files have to exist, "-" reads the configuration from stdin.
+//
+// DefaultOptions adds it as --config if Config.ConfigMode is set, it can be
+// set with $<APP>_CONFIG as well.
+type ConfigFlag []string
+
+type configFlag struct {
+	Config ConfigFlag `help:"Configuration file (repeatable, - reads from stdin)." env:"${king_config_env}" placeholder:"FILE"`
+}
+
+// EffectiveConfigFiles returns the configuration files and their status
+// that were used to parse *kong.Context. This includes files given with
+// ConfigFlag.
+func EffectiveConfigFiles(ctx *kong.Context) ([]ConfigFile, error) {
+	var l *loader
+
+	_, _ = ctx.Call(func(b *loader) {
+		l = b
+	})
+
+	if l != nil {
+		if files, ok := l.effective(ctx); ok {
+			return files, nil
+		}
+	}
+
+	return ConfigFiles(ctx.Model.Vars())
+}
+
+// loader registers the resolvers of the configuration files and the
+// environment when a command line is parsed.
+type loader struct {
+	config  Config
+	tracker *tracker
+	stdin   io.Reader
+
+	mu       sync.Mutex
+	ctx      *kong.Context
+	files    []ConfigFile
+	layers   []kong.Resolver
+	policies []policy
+}
+
+func newLoader(c Config, t *tracker) *loader {
+	return &loader{
+		config:  c,
+		tracker: t,
+		stdin:   os.Stdin,
+	}
+}
+
+// beforeResolve is a kong BeforeResolve hook. Kong calls it for every
+// element of the path, the resolvers are only added once for the
+// application.
+func (l *loader) beforeResolve(ctx *kong.Context, path *kong.Path) error {
+	if path.App == nil {
+		return nil
+	}
+
+	paths, err := l.paths(ctx)
+	if err != nil {
+		return err
+	}
+
+	identities := l.identities()
+	files := []ConfigFile{}
+	resolvers := []kong.Resolver{}
+	policies := []policy{}
+	profile, _ := flagOf[ProfileFlag](ctx)
+	found := false
+
+	for _, p := range paths {
+		if p.kind == envPath {
+			resolvers = append(resolvers, newCachedResolver(l.tracker.resolver(EnvResolver(), envOrigin)))
+			continue
+		}
+
+		r, f, err := l.open(p, string(profile), &found)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case r == nil:
+		case p.kind == policyPath:
+			policies = append(policies, policy{path: p.path, resolver: newCachedResolver(l.resolver(ctx, r, p, len(files), identities))})
+		default:
+			resolvers = append(resolvers, newCachedResolver(l.resolver(ctx, r, p, len(files), identities)))
+		}
+
+		files = append(files, f)
+	}
+
+	if profile != "" && !found {
+		return fmt.Errorf("unknown profile %q", profile)
+	}
+
+	l.mu.Lock()
+	l.ctx = ctx
+	l.files = files
+	l.layers = resolvers
+	l.policies = policies
+	l.mu.Unlock()
+
+	for _, r := range resolvers {
+		ctx.AddResolver(r)
+	}
+
+	for _, p := range policies {
+		ctx.AddResolver(p.resolver)
+	}
+
+	return nil
+}
+
+// beforeApply is a kong BeforeApply hook. It merges the values of flags
+// with a merge strategy and enforces the policy files.
+func (l *loader) beforeApply(ctx *kong.Context, path *kong.Path) error {
+	if path.App == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	layers, policies := l.layers, l.policies
+	l.mu.Unlock()
+
+	for _, parent := range ctx.Path {
+		for _, flag := range parent.Flags {
+			if err := mergeFlag(ctx, parent, flag, layers); err != nil {
+				return err
+			}
+
+			if err := l.enforcePolicy(ctx, parent, flag, layers, policies); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolver wraps the resolver r of the configuration file with index i.
+// Values are interpolated first, then decrypted and then resolved by the
+// secret providers. Files of key directories hold raw values, they are
+// neither interpolated nor resolved by the secret providers. Values of .env
+// files are not interpolated, they are quoted like in a shell instead.
+func (l *loader) resolver(ctx *kong.Context, r kong.Resolver, p configPath, i int, identities *ageIdentities) kong.Resolver {
+	path := p.path
+	raw := p.kind == keyDirPath || p.kind == credentialsPath
+	dotEnv := p.kind == dotEnvPath || l.config.FileResolver == DotEnv
+
+	if l.config.Interpolate && !raw && !dotEnv {
+		r = interpolatingResolver{Resolver: r, path: path}
+	}
+
+	r = decryptingResolver{Resolver: r, path: path, identities: identities, tracker: l.tracker}
+
+	if len(l.config.SecretProviders) > 0 && !raw {
+		r = secretResolver{Resolver: r, path: path, providers: l.config.SecretProviders, tracker: l.tracker}
+	}
+
+	if p.kind == credentialsPath {
+		r = sensitiveResolver{Resolver: r, tracker: l.tracker}
+	}
+
+	r = fragmentResolver{Resolver: r, loader: l, ctx: ctx, index: i}
+
+	o := Origin{Source: SourceFile, Location: path, Overlay: p.overlay}
+
+	switch p.kind {
+	case embeddedPath:
+		o.Source = SourceEmbedded
+	case policyPath:
+		o.Source = SourcePolicy
+	case dotEnvPath:
+		o.Source = SourceDotEnv
+	case keyDirPath, credentialsPath:
+		o.Source = SourceDirectory
+	}
+
+	return l.tracker.resolver(r, staticOrigin(o))
+}
+
+// identities returns the age identities to decrypt values. The identity
+// file from the environment takes precedence over Config.AgeIdentityFile.
+func (l *loader) identities() *ageIdentities {
+	a := &ageIdentities{
+		path:   l.config.AgeIdentityFile,
+		envVar: envVarName(l.config.Name, "age_identity_file"),
+	}
+
+	if p, ok := os.LookupEnv(a.envVar); ok {
+		a.path = p
+	}
+
+	return a
+}
+
+func (l *loader) effective(ctx *kong.Context) ([]ConfigFile, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	files := make([]ConfigFile, 0, len(l.files))
+	for _, f := range l.files {
+		f.Keys = slices.Clone(f.Keys)
+		files = append(files, f)
+	}
+
+	return files, l.ctx == ctx
+}
+
+// setKey records that the file with index i set the flag name.
+func (l *loader) setKey(ctx *kong.Context, i int, name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ctx != ctx || slices.Contains(l.files[i].Keys, name) {
+		return
+	}
+
+	l.files[i].Keys = append(l.files[i].Keys, name)
+}
+
+// fragmentResolver records the keys a configuration file sets.
+type fragmentResolver struct {
+	kong.Resolver
+	loader *loader
+	ctx    *kong.Context
+	index  int
+}
+
+func (r fragmentResolver) Resolve(ctx *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
+	v, err := r.Resolver.Resolve(ctx, parent, flag)
+	if err == nil && v != nil {
+		r.loader.setKey(ctx, r.index, flag.Name)
+	}
+
+	return v, err
+}
+
+// cachedResolver resolves every flag only once. Kong resolves the layers
+// and they are resolved again to merge flags and to enforce policies,
+// secret providers must not run twice.
+type cachedResolver struct {
+	kong.Resolver
+	values map[*kong.Flag]cachedValue
+}
+
+type cachedValue struct {
+	value any
+	err   error
+}
+
+func newCachedResolver(r kong.Resolver) *cachedResolver {
+	return &cachedResolver{
+		Resolver: r,
+		values:   map[*kong.Flag]cachedValue{},
+	}
+}
+
+func (r *cachedResolver) Resolve(ctx *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
+	v, ok := r.values[flag]
+	if !ok {
+		v.value, v.err = r.Resolver.Resolve(ctx, parent, flag)
+		r.values[flag] = v
+	}
+
+	return v.value, v.err
+}
+
+// paths returns the paths of the enabled layers, ordered from the least to
+// the most important. Directories and glob patterns are expanded to the
+// files they contain. The embedded configuration is always the least
+// important.
+func (l *loader) paths(ctx *kong.Context) ([]configPath, error) {
+	paths := []configPath{}
+
+	if l.config.EmbeddedConfig != nil {
+		paths = append(paths, configPath{path: l.config.EmbeddedConfigPath, explicit: true, kind: embeddedPath})
+	}
+
+	for _, layer := range slices.Backward(l.config.Layers) {
+		var (
+			p   []configPath
+			err error
+		)
+
+		switch layer {
+		case LayerEnv:
+			p = []configPath{{kind: envPath}}
+		case LayerDotEnv:
+			p, err = l.dotEnvPaths()
+		case LayerSecrets:
+			p = l.secretPaths()
+		case LayerFile:
+			p, err = l.filePaths(ctx)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, p...)
+	}
+
+	policies, err := l.policyPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(paths, policies...), nil
+}
+
+// filePaths returns the configuration files of Config.ConfigPaths and
+// ConfigFlag.
+func (l *loader) filePaths(ctx *kong.Context) ([]configPath, error) {
+	paths := []configPath{}
+	explicit := []configPath{}
+	overlay, _ := flagOf[OverlayFlag](ctx)
+	env := string(overlay)
+
+	if env != "" && (filepath.Base(env) != env || env == "." || env == "..") {
+		return nil, fmt.Errorf("invalid environment %q", env)
+	}
+
+	configs, _ := flagOf[ConfigFlag](ctx)
+
+	for _, p := range configs {
+		if p == stdinPath {
+			explicit = append(explicit, configPath{path: p, explicit: true})
+			continue
+		}
+
+		files, err := l.configFiles(p, true, env)
+		if err != nil {
+			return nil, fmt.Errorf("config file: %w", err)
+		}
+
+		explicit = append(explicit, files...)
+	}
+
+	if len(explicit) == 0 || l.config.ConfigMode == ConfigFlagPrepend {
+		for _, p := range l.config.ConfigPaths {
+			files, err := l.configFiles(p, false, env)
+			if err != nil {
+				return nil, err
+			}
+
+			paths = append(paths, files...)
+		}
+	}
+
+	return append(paths, explicit...), nil
+}
+
+// secretPaths returns the directories of Config.KeyDirs and the systemd
+// credentials directory.
+func (l *loader) secretPaths() []configPath {
+	paths := []configPath{}
+
+	for _, dir := range l.config.KeyDirs {
+		paths = append(paths, configPath{path: kong.ExpandPath(dir), kind: keyDirPath})
+	}
+
+	if dir := os.Getenv(credentialsDirectoryEnv); l.config.Credentials && dir != "" {
+		paths = append(paths, configPath{path: dir, kind: credentialsPath})
+	}
+
+	return paths
+}
+
+// dotEnvPaths returns the files of Config.DotEnvFiles.
+func (l *loader) dotEnvPaths() ([]configPath, error) {
+	paths := []configPath{}
+
+	for _, p := range l.config.DotEnvFiles {
+		files, err := fragments(kong.ExpandPath(p), DotEnv.extension())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			paths = append(paths, configPath{path: file, kind: dotEnvPath})
+		}
+	}
+
+	return paths, nil
+}
+
+// configFiles returns the configuration files of p, each followed by its
+// overlay for the environment env. Overlays are optional, even for explicit
+// files.
+func (l *loader) configFiles(p string, explicit bool, env string) ([]configPath, error) {
+	files, err := fragments(kong.ExpandPath(p), l.config.FileResolver.extension())
+	if err != nil {
+		return nil, err
+	}
+
+	if explicit && len(files) == 0 {
+		return nil, fmt.Errorf("%s: no configuration files found", p)
+	}
+
+	if l.config.Overlays {
+		files = withoutOverlays(files)
+	}
+
+	paths := []configPath{}
+
+	for _, file := range files {
+		paths = append(paths, configPath{path: file, explicit: explicit})
+
+		if env != "" {
+			paths = append(paths, configPath{path: overlayPath(file, env), overlay: env})
+		}
+	}
+
+	return paths, nil
+}
+
+// pathKind is the kind of a configPath.
+type pathKind int
+
+const (
+	configFilePath pathKind = iota
+	keyDirPath
+	credentialsPath
+	dotEnvPath
+	envPath
+	policyPath
+	embeddedPath
+)
+
+type configPath struct {
+	path     string
+	explicit bool
+	kind     pathKind
+	overlay  string
+}
+
+// open returns the resolver of p. If profiles are enabled, profile is
+// applied to configuration files and found is set if one of them defines
+// it.
+func (l *loader) open(p configPath, profile string, found *bool) (kong.Resolver, ConfigFile, error) {
+	switch {
+	case p.kind == keyDirPath || p.kind == credentialsPath:
+		return openKeyDir(p.path)
+	case p.kind == dotEnvPath:
+		return l.load(dotEnvResolver, p)
+	case p.kind == policyPath:
+		r, f, err := l.load(NewFileResolver(l.config.FileResolver), p)
+		f.Policy = true
+
+		return r, f, err
+	case l.config.FileResolver == DotEnv:
+		return l.load(dotEnvResolver, p)
+	default:
+		return l.load(l.mapLoader(p, profile, found), p)
+	}
+}
+
+// mapLoader returns a loader for the configuration file p that resolves
+// includes and applies profile if they are enabled. The embedded
+// configuration can not include files.
+func (l *loader) mapLoader(p configPath, profile string, found *bool) kong.ConfigurationLoader {
+	decode := l.config.FileResolver.decoder()
+
+	return func(r io.Reader) (kong.Resolver, error) {
+		values, err := decode(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if l.config.Includes && p.kind != embeddedPath {
+			values, err = resolveIncludes(values, []string{p.path}, l.config.FileResolver)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if l.config.Profiles {
+			var ok bool
+
+			values, ok, err = applyProfile(values, profile)
+			if err != nil {
+				return nil, err
+			}
+
+			*found = *found || ok
+		}
+
+		return mapResolver(values), nil
+	}
+}
+
+// flagOf returns the value of the first flag of type T in ctx.
+func flagOf[T any](ctx *kong.Context) (T, bool) {
+	for _, f := range ctx.Flags() {
+		if v, ok := ctx.FlagValue(f).(T); ok {
+			return v, true
+		}
+	}
+
+	var zero T
+
+	return zero, false
+}
+
+// load loads a configuration file. Files from the search paths are
+// skipped if they do not exist or are not readable, explicit files have to
+// exist.
+func (l *loader) load(load kong.ConfigurationLoader, p configPath) (kong.Resolver, ConfigFile, error) {
+	if p.explicit && p.path == stdinPath {
+		data, err := io.ReadAll(l.stdin)
+		if err != nil {
+			return nil, ConfigFile{}, fmt.Errorf("stdin: %w", err)
+		}
+
+		r, err := load(bytes.NewReader(data))
+		if err != nil {
+			return nil, ConfigFile{}, fmt.Errorf("stdin: %w", err)
+		}
+
+		return r, ConfigFile{Path: stdinPath, Status: StatusParsed}, nil
+	}
+
+	path := p.path
+	f := ConfigFile{Path: path, Status: StatusParsed, Overlay: p.overlay, Embedded: p.kind == embeddedPath}
+
+	var (
+		file io.ReadCloser
+		err  error
+	)
+
+	if p.kind == embeddedPath {
+		file, err = l.config.EmbeddedConfig.Open(path)
+	} else {
+		file, err = os.Open(filepath.Clean(path))
+	}
+
+	if err != nil {
+		switch {
+		case p.explicit:
+			return nil, f, fmt.Errorf("config file: %w", err)
+		case os.IsNotExist(err):
+			f.Status = StatusNotFound
+			return nil, f, nil
+		case os.IsPermission(err):
+			f.Status = StatusPermissionDenied
+			return nil, f, nil
+		default:
+			return nil, f, err
+		}
+	}
+
+	defer file.Close()
+
+	r, err := load(file)
+	if err != nil {
+		return nil, f, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return r, f, nil
+}
+
+// fragments returns the configuration files of path in lexical order. A
+// directory contains all files with extension ext, a glob pattern all
+// matching files. Hidden files are skipped. A path that is neither a
+// directory nor a glob pattern is returned as is, even if it does not
+// exist, as does a glob pattern without matches.
+func fragments(path, ext string) ([]string, error) {
+	if isGlob(path) {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		files := []string{}
+
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && !info.IsDir() && !hidden(m) {
+				files = append(files, m)
+			}
+		}
+
+		if len(files) == 0 {
+			return []string{path}, nil
+		}
+
+		return files, nil
+	}
+
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return []string{path}, nil
+	}
+
+	files := []string{}
+
+	for _, e := range entries {
+		if e.IsDir() || hidden(e.Name()) || filepath.Ext(e.Name()) != "."+ext {
+			continue
+		}
+
+		files = append(files, filepath.Join(path, e.Name()))
+	}
+
+	return files, nil
+}
+
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+func hidden(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
@@ -0,0 +1,131 @@
+package king
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/alecthomas/kong"
+)
+
+const mergeTag = "merge"
+
+// All merge strategies of the `merge:""` tag.
+//
+// By default the value of the most important source replaces all others.
+// With `merge:"append"` the values of a slice flag from configuration
+// files, the environment and the command line are appended in the order of
+// their precedence, with `merge:"deep"` the keys of a map flag are merged
+// and the most important source wins for each key:
+//
+//	type CLI struct {
+//	    Labels map[string]string `merge:"deep"`
+//	    Peers  []string          `merge:"append"`
+//	}
+const (
+	MergeReplace = "replace"
+	MergeAppend  = "append"
+	MergeDeep    = "deep"
+)
+
+// mergeStrategy returns the merge strategy of flag.
+func mergeStrategy(flag *kong.Flag) (string, error) {
+	s := flag.Tag.Get(mergeTag)
+
+	switch {
+	case s == "" || s == MergeReplace:
+		return MergeReplace, nil
+	case s == MergeAppend && flag.IsSlice():
+		return s, nil
+	case s == MergeDeep && flag.IsMap():
+		return s, nil
+	case s == MergeAppend || s == MergeDeep:
+		return "", fmt.Errorf("%s: merge strategy %q is not supported for %s", flag.ShortSummary(), s, flag.Target.Type())
+	default:
+		return "", fmt.Errorf("%s: unknown merge strategy %q", flag.ShortSummary(), s)
+	}
+}
+
+// mergeFlag replaces the value of flag by the merged values from all
+// layers, ordered from the least to the most important, and from the
+// command line if flag has a merge strategy.
+func mergeFlag(ctx *kong.Context, parent *kong.Path, flag *kong.Flag, layers []kong.Resolver) error {
+	strategy, err := mergeStrategy(flag)
+	if err != nil || strategy == MergeReplace {
+		return err
+	}
+
+	set := flagPath(ctx, flag)
+	if set == nil {
+		return nil
+	}
+
+	merged := reflect.New(flag.Target.Type()).Elem()
+
+	for _, r := range layers {
+		raw, err := r.Resolve(ctx, parent, flag)
+		if err != nil {
+			return err
+		}
+
+		if raw == nil {
+			continue
+		}
+
+		v, err := parseFlagValue(flag, raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", flag.ShortSummary(), err)
+		}
+
+		mergeValue(merged, v)
+	}
+
+	current := ctx.Value(set)
+
+	if !set.Resolved {
+		mergeValue(merged, current)
+	}
+
+	current.Set(merged)
+
+	return nil
+}
+
+// parseFlagValue parses the resolved value raw of flag.
+func parseFlagValue(flag *kong.Flag, raw any) (reflect.Value, error) {
+	v := reflect.New(flag.Target.Type()).Elem()
+	err := flag.Parse(kong.Scan().PushTyped(raw, kong.FlagValueToken), v)
+
+	return v, err
+}
+
+// mergeValue appends the slice src to dst or merges the map src into dst.
+// Maps nested in maps are merged recursively.
+func mergeValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Slice:
+		dst.Set(reflect.AppendSlice(dst, src))
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		}
+
+		iter := src.MapRange()
+		for iter.Next() {
+			d, s := dst.MapIndex(iter.Key()), iter.Value()
+			if d.IsValid() && s.Kind() == reflect.Map {
+				m := reflect.New(s.Type()).Elem()
+				mergeValue(m, d)
+				mergeValue(m, s)
+				s = m
+			}
+
+			dst.SetMapIndex(iter.Key(), s)
+		}
+	default:
+		dst.Set(src)
+	}
+}
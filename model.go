@@ -0,0 +1,92 @@
+package king
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+const sensitiveTag = "sensitive"
+
+// modelFlags returns the flags of node and all its descendants, parents first.
+func modelFlags(node *kong.Node) []*kong.Flag {
+	flags := []*kong.Flag{}
+
+	walk(node, func(n *kong.Node) {
+		flags = append(flags, n.Flags...)
+	})
+
+	return flags
+}
+
+// walk calls fn for node and all its descendants, parents first.
+func walk(node *kong.Node, fn func(*kong.Node)) {
+	fn(node)
+
+	for _, child := range node.Children {
+		walk(child, fn)
+	}
+}
+
+// typeName returns a short name of the type of value.
+func typeName(value *kong.Value) string {
+	switch {
+	case value.IsCounter():
+		return "counter"
+	case value.IsBool():
+		return "bool"
+	case value.Tag.Type != "":
+		return value.Tag.Type
+	case value.Target.Type() == reflect.TypeOf(time.Duration(0)):
+		return "duration"
+	}
+
+	return value.Target.Type().String()
+}
+
+// isSensitive reports whether value has a `sensitive:""` tag.
+func isSensitive(value *kong.Value) bool {
+	return value.Tag.Has(sensitiveTag)
+}
+
+// configurable reports whether flag can be set in a configuration file.
+// Hidden flags and flags that trigger an action are not configurable.
+func configurable(flag *kong.Flag) bool {
+	if flag.Hidden || ignoredFlagsNames[flag.Name] {
+		return false
+	}
+
+	switch flag.Target.Interface().(type) {
+	case VersionFlag, ShowConfig, EnvHelpFlag, SampleConfigFlag, JSONSchemaFlag, CompletionFlag, DocsFlag,
+		ConfigFlag, OverlayFlag, ProfileFlag:
+		return false
+	}
+
+	return true
+}
+
+// parsedFlagValue returns the value of the flag of path. Flags that act in
+// BeforeApply are not applied yet, so it is taken from the parsed value.
+func parsedFlagValue[T any](ctx *kong.Context, path *kong.Path) T {
+	v, _ := ctx.FlagValue(path.Flag).(T)
+
+	return v
+}
+
+// popChoice pops the value of a flag and checks that it is one of choices.
+func popChoice(ctx *kong.DecodeContext, what string, choices ...string) (string, error) {
+	v, err := ctx.Scan.PopValue(what)
+	if err != nil {
+		return "", err
+	}
+
+	s := v.String()
+	if !contains(choices, s) {
+		return "", fmt.Errorf("%s must be one of %s but got %q", what, strings.Join(choices, ", "), s)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,50 @@
+package king
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const overlayEnvKey = "king_overlay_env"
+
+// OverlayFlag selects the environment of overlay configuration files.
+//
+// DefaultOptions adds it as --env if Config.Overlays is set, it can be set
+// with $<APP>_ENV as well. For the environment "staging", config.yaml is
+// followed by config.staging.yaml, values of the overlay win.
+type OverlayFlag string
+
+type overlayFlag struct {
+	Env OverlayFlag `help:"Environment, config.<env>.<ext> overlays each configuration file." env:"${king_overlay_env}" placeholder:"ENV"`
+}
+
+// overlayPath returns the path of the overlay of path for env.
+func overlayPath(path, env string) string {
+	ext := filepath.Ext(path)
+
+	return strings.TrimSuffix(path, ext) + "." + env + ext
+}
+
+// withoutOverlays removes overlay files from files, config.staging.yaml
+// is removed if config.yaml is in files.
+func withoutOverlays(files []string) []string {
+	set := map[string]bool{}
+	for _, f := range files {
+		set[f] = true
+	}
+
+	l := []string{}
+
+	for _, f := range files {
+		ext := filepath.Ext(f)
+		base := strings.TrimSuffix(f, ext)
+
+		if i := strings.LastIndex(base, "."); i > len(filepath.Dir(f)) && set[base[:i]+ext] {
+			continue
+		}
+
+		l = append(l, f)
+	}
+
+	return l
+}
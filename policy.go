@@ -0,0 +1,197 @@
+package king
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// Enforcement defines how a violation of a rule is handled.
+type Enforcement int
+
+// All Enforcements.
+const (
+	// EnforceWarn writes a warning to stderr.
+	EnforceWarn Enforcement = iota
+	// EnforceError fails the parsing of the command line.
+	EnforceError
+)
+
+// enforce returns an error for msg or writes it as a warning to stderr.
+func (e Enforcement) enforce(ctx *kong.Context, msg string) error {
+	if e == EnforceError {
+		return errors.New(msg)
+	}
+
+	fmt.Fprintf(ctx.Stderr, "warning: %s\n", msg)
+
+	return nil
+}
+
+// policy is a parsed policy file.
+type policy struct {
+	path     string
+	resolver kong.Resolver
+}
+
+// policyPaths returns the files of Config.PolicyFiles.
+//
+// Policy files are administrator managed configuration files, the values
+// they set override all other layers including the command line. An
+// attempt to set a locked flag differently is handled according to
+// Config.PolicyEnforcement.
+func (l *loader) policyPaths() ([]configPath, error) {
+	paths := []configPath{}
+
+	for _, p := range l.config.PolicyFiles {
+		files, err := fragments(kong.ExpandPath(p), l.config.FileResolver.extension())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			paths = append(paths, configPath{path: file, kind: policyPath})
+		}
+	}
+
+	return paths, nil
+}
+
+// enforcePolicy sets flag to the value of the most important policy file
+// that locks it.
+func (l *loader) enforcePolicy(ctx *kong.Context, parent *kong.Path, flag *kong.Flag, layers []kong.Resolver, policies []policy) error {
+	var (
+		locked reflect.Value
+		path   string
+	)
+
+	for _, p := range slices.Backward(policies) {
+		raw, err := p.resolver.Resolve(ctx, parent, flag)
+		if err != nil {
+			return err
+		}
+
+		if raw != nil {
+			if locked, err = parseFlagValue(flag, raw); err != nil {
+				return fmt.Errorf("%s: %w", p.path, err)
+			}
+
+			path = p.path
+
+			break
+		}
+	}
+
+	if path == "" {
+		return nil
+	}
+
+	set := flagPath(ctx, flag)
+	violated := set != nil && !set.Resolved && !reflect.DeepEqual(ctx.Value(set).Interface(), locked.Interface())
+
+	for _, r := range layers {
+		raw, err := r.Resolve(ctx, parent, flag)
+		if err != nil {
+			return err
+		}
+
+		if raw == nil {
+			continue
+		}
+
+		v, err := parseFlagValue(flag, raw)
+		if err != nil {
+			return err
+		}
+
+		violated = violated || !reflect.DeepEqual(v.Interface(), locked.Interface())
+	}
+
+	// Kong did not resolve flags set on the command line, the policy is the
+	// effective origin of them too.
+	l.tracker.record(ctx, flag.Name, Origin{Source: SourcePolicy, Location: path})
+
+	if set != nil {
+		ctx.Value(set).Set(locked)
+		set.Resolved = true
+	}
+
+	if violated {
+		return l.config.PolicyEnforcement.enforce(ctx, fmt.Sprintf("--%s is locked by policy %s", flag.Name, path))
+	}
+
+	return nil
+}
+
+// markLocked is a kong PostBuild option that marks the flags locked by a
+// policy file in the help.
+func (l *loader) markLocked(k *kong.Kong) error {
+	paths, err := l.policyPaths()
+	if err != nil {
+		return err
+	}
+
+	resolvers := []kong.Resolver{}
+
+	for _, p := range paths {
+		r, _, err := l.open(p, "", nil)
+		if err != nil {
+			return err
+		}
+
+		if r != nil {
+			resolvers = append(resolvers, r)
+		}
+	}
+
+	ctx := &kong.Context{Kong: k}
+
+	walk(k.Model.Node, func(n *kong.Node) {
+		parent := &kong.Path{Command: n}
+		if n.Parent == nil {
+			parent = &kong.Path{App: k.Model}
+		}
+
+		for _, f := range n.Flags {
+			for _, r := range resolvers {
+				v, rerr := r.Resolve(ctx, parent, f)
+				if rerr != nil {
+					err = errors.Join(err, rerr)
+					break
+				}
+
+				if v != nil {
+					f.Help = lockedHelp(f.Help)
+					break
+				}
+			}
+		}
+	})
+
+	return err
+}
+
+func lockedHelp(help string) string {
+	if h, ok := strings.CutSuffix(help, "."); ok {
+		return h + " (locked by policy)."
+	}
+
+	return strings.TrimSpace(help + " (locked by policy)")
+}
+
+// flagPath returns the element of the path of ctx that sets flag or nil.
+func flagPath(ctx *kong.Context, flag *kong.Flag) *kong.Path {
+	var set *kong.Path
+
+	for _, p := range ctx.Path {
+		if p.Flag == flag {
+			set = p
+		}
+	}
+
+	return set
+}
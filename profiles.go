@@ -0,0 +1,114 @@
+package king
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	profileEnvKey = "king_profile_env"
+	profilesKey   = "king_profiles"
+
+	profilesSection = "profiles"
+	inheritsKey     = "inherits"
+)
+
+// ProfileFlag selects a profile of the configuration files.
+//
+// DefaultOptions adds it as --profile if Config.Profiles is set, it can be
+// set with $<APP>_PROFILE as well. The keys of the profile in the profiles
+// section of a configuration file override the top level keys. A profile
+// can inherit the keys of another profile of the same file:
+//
+//	listen: :8080
+//	profiles:
+//	  dev:
+//	    debug: true
+//	  prod:
+//	    inherits: dev
+//	    debug: false
+type ProfileFlag string
+
+type profileFlag struct {
+	Profile ProfileFlag `help:"Profile of the configuration files." env:"${king_profile_env}" placeholder:"PROFILE"`
+}
+
+// applyProfile merges profile and the profiles it inherits from into the
+// top level of values.
+func applyProfile(values map[string]any, profile string) (map[string]any, bool, error) {
+	profiles, ok := values[profilesSection].(map[string]any)
+	if _, exists := values[profilesSection]; exists && !ok {
+		return nil, false, fmt.Errorf("%s is not a section", profilesSection)
+	}
+
+	delete(values, profilesSection)
+
+	if profile == "" || profiles[profile] == nil {
+		return values, false, nil
+	}
+
+	chain := []string{}
+
+	for name := profile; name != ""; {
+		for _, n := range chain {
+			if n == name {
+				return nil, false, fmt.Errorf("profile %s: inheritance cycle %s", profile, strings.Join(append(chain, name), " -> "))
+			}
+		}
+
+		chain = append(chain, name)
+
+		p, ok := profiles[name].(map[string]any)
+		if !ok {
+			return nil, false, fmt.Errorf("profile %s: unknown profile %q", chain[0], name)
+		}
+
+		parent, ok := p[inheritsKey].(string)
+		if _, exists := p[inheritsKey]; exists && !ok {
+			return nil, false, fmt.Errorf("profile %s: %s is not a string", name, inheritsKey)
+		}
+
+		name = parent
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		p := profiles[chain[i]].(map[string]any)
+		delete(p, inheritsKey)
+		merge(values, p)
+	}
+
+	return values, true, nil
+}
+
+// merge merges src into dst, nested sections are merged recursively. Keys
+// that are equal once normalised are the same key, the key of src replaces
+// the key of dst.
+func merge(dst, src map[string]any) {
+	for k, v := range src {
+		existing := k
+
+		for key := range dst {
+			if normalizeKey(key) == normalizeKey(k) {
+				existing = key
+				break
+			}
+		}
+
+		d, isSection := dst[existing].(map[string]any)
+		delete(dst, existing)
+
+		s, ok := v.(map[string]any)
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		if !isSection {
+			d = map[string]any{}
+		}
+
+		dst[k] = d
+
+		merge(d, s)
+	}
+}
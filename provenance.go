@@ -0,0 +1,225 @@
+package king
+
+import (
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/alecthomas/kong"
+)
+
+// All known sources of flag values.
+const (
+	SourceDefault   = "default"
+	SourceFlag      = "flag"
+	SourceEnv       = "env"
+	SourceDotEnv    = "dotenv"
+	SourceFile      = "file"
+	SourceDirectory = "directory"
+	SourcePolicy    = "policy"
+	SourceEmbedded  = "embedded"
+)
+
+// Origin describes where the effective value of a flag came from. Overlay
+// is the environment of an overlay configuration file.
+type Origin struct {
+	Source   string `json:"source" yaml:"source"`
+	Location string `json:"location,omitempty" yaml:"location,omitempty"`
+	Overlay  string `json:"overlay,omitempty" yaml:"overlay,omitempty"`
+}
+
+func (o Origin) String() string {
+	s := o.Source
+	if o.Location != "" {
+		s += ":" + o.Location
+	}
+
+	if o.Overlay != "" {
+		s += " (overlay " + o.Overlay + ")"
+	}
+
+	return s
+}
+
+// Setting is the effective value of a flag together with its origin.
+type Setting struct {
+	Value  any `json:"value" yaml:"value"`
+	Origin `yaml:",inline"`
+}
+
+// Settings maps flag names to their effective settings.
+type Settings map[string]Setting
+
+// Origins returns the origin of every flag in *kong.Context.
+//
+// Origins of values from resolvers are only known if the parser was
+// created with DefaultOptions.
+func Origins(ctx *kong.Context) map[string]Origin {
+	t := trackerFor(ctx)
+	m := map[string]Origin{}
+
+	for _, f := range ctx.Flags() {
+		m[f.Name] = originOf(ctx, t, f)
+	}
+
+	return m
+}
+
+// EffectiveSettings returns the flags, their values and their origins from *kong.Context.
+//
+// Values are redacted the same way as in FlagMap.
+func EffectiveSettings(ctx *kong.Context, redactFlags ...*regexp.Regexp) Settings {
+	r := redactor(redactFlags)
+	t := trackerFor(ctx)
+	origins := Origins(ctx)
+	s := Settings{}
+
+	for _, f := range ctx.Flags() {
+		s[f.Name] = Setting{
+			Value:  redactValue(ctx, t, f, r),
+			Origin: origins[f.Name],
+		}
+	}
+
+	return s
+}
+
+func originOf(ctx *kong.Context, t *tracker, f *kong.Flag) Origin {
+	for _, p := range ctx.Path {
+		if p.Flag != f {
+			continue
+		}
+
+		if !p.Resolved {
+			return Origin{Source: SourceFlag}
+		}
+
+		if o, ok := t.lookup(ctx, f.Name); ok {
+			return o
+		}
+	}
+
+	for _, env := range f.Tag.Envs {
+		if _, ok := os.LookupEnv(env); ok {
+			return Origin{Source: SourceEnv, Location: env}
+		}
+	}
+
+	return Origin{Source: SourceDefault}
+}
+
+// tracker records which resolver provided the value of a flag and which
+// resolved values are sensitive.
+type tracker struct {
+	mu        sync.Mutex
+	ctx       *kong.Context
+	origins   map[string]Origin
+	sensitive map[string]bool
+}
+
+func trackerFor(ctx *kong.Context) *tracker {
+	t := &tracker{}
+
+	_, _ = ctx.Call(func(b *tracker) {
+		t = b
+	})
+
+	return t
+}
+
+// resolver wraps r and records origin o for every flag r resolves. Kong uses
+// the last resolved value, so the last recorded origin is the effective one.
+func (t *tracker) resolver(r kong.Resolver, o func(*kong.Context, *kong.Flag) Origin) kong.Resolver {
+	return trackedResolver{
+		Resolver: r,
+		tracker:  t,
+		origin:   o,
+	}
+}
+
+func (t *tracker) record(ctx *kong.Context, name string, o Origin) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.reset(ctx)
+	t.origins[name] = o
+}
+
+// markSensitive records that a resolved value of flag name is sensitive.
+func (t *tracker) markSensitive(ctx *kong.Context, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.reset(ctx)
+	t.sensitive[name] = true
+}
+
+func (t *tracker) isSensitive(ctx *kong.Context, name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.ctx == ctx && t.sensitive[name]
+}
+
+// reset forgets everything recorded if ctx is a new context. t.mu has to be
+// held.
+func (t *tracker) reset(ctx *kong.Context) {
+	if t.ctx == ctx {
+		return
+	}
+
+	t.ctx = ctx
+	t.origins = map[string]Origin{}
+	t.sensitive = map[string]bool{}
+}
+
+func (t *tracker) lookup(ctx *kong.Context, name string) (Origin, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.ctx != ctx {
+		return Origin{}, false
+	}
+
+	o, ok := t.origins[name]
+
+	return o, ok
+}
+
+type trackedResolver struct {
+	kong.Resolver
+	tracker *tracker
+	origin  func(*kong.Context, *kong.Flag) Origin
+}
+
+func (r trackedResolver) Resolve(ctx *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
+	v, err := r.Resolver.Resolve(ctx, parent, flag)
+	if err != nil || v == nil {
+		return v, err
+	}
+
+	r.tracker.record(ctx, flag.Name, r.origin(ctx, flag))
+
+	return v, nil
+}
+
+// envOrigin returns the first set variable of flag. It is only called for
+// flags EnvResolver resolved, so one of them is set.
+func envOrigin(ctx *kong.Context, flag *kong.Flag) Origin {
+	o := Origin{Source: SourceEnv}
+
+	for _, name := range envVarNames(ctx.Model.Name, flag.Value) {
+		if _, ok := os.LookupEnv(name); ok {
+			o.Location = name
+			break
+		}
+	}
+
+	return o
+}
+
+func staticOrigin(o Origin) func(*kong.Context, *kong.Flag) Origin {
+	return func(*kong.Context, *kong.Flag) Origin {
+		return o
+	}
+}
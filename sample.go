@@ -0,0 +1,343 @@
+package king
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+const fileResolverKey = "king_file_resolver"
+
+// SampleConfigFlag prints a commented sample configuration file in the format
+// of the configured FileResolver.
+type SampleConfigFlag bool
+
+// BeforeApply is the actual sample-config command.
+func (s SampleConfigFlag) BeforeApply(app *kong.Kong, vars kong.Vars) error {
+	if err := WriteSampleConfig(app.Stdout, app.Model, FileResolver(vars[fileResolverKey])); err != nil {
+		return err
+	}
+
+	app.Exit(0)
+
+	return nil
+}
+
+// WriteSampleConfig writes a sample configuration file for the application.
+//
+// The help of each flag is written as comment and the value is set to the
+// default. Flags with a `sensitive:""` tag are commented out. Flags of
+// commands are nested in sections named after the commands. For DotEnv
+// the environment variables are written as by WriteDotEnv.
+func WriteSampleConfig(w io.Writer, app *kong.Application, f FileResolver) error {
+	if f == DotEnv {
+		WriteDotEnv(w, envVars(app))
+
+		return nil
+	}
+
+	var s sampleWriter
+
+	switch f {
+	case TOML:
+		s = tomlSample{}
+	case INI:
+		s = iniSample{}
+	case Properties:
+		s = propertiesSample{}
+	default:
+		s = yamlSample{}
+	}
+
+	var err error
+
+	walk(app.Node, func(n *kong.Node) {
+		if err != nil || len(configurableFlags(n, true)) == 0 {
+			return
+		}
+
+		err = s.write(w, commandPath(n), configurableFlags(n, false))
+	})
+
+	return err
+}
+
+// configurableFlags returns the configurable flags of node and, if
+// recursive is true, of all its descendants.
+func configurableFlags(node *kong.Node, recursive bool) []*kong.Flag {
+	flags := []*kong.Flag{}
+	nodes := []*kong.Node{node}
+
+	if recursive {
+		nodes = nodes[:0]
+
+		walk(node, func(n *kong.Node) {
+			nodes = append(nodes, n)
+		})
+	}
+
+	for _, n := range nodes {
+		for _, f := range n.Flags {
+			if configurable(f) {
+				flags = append(flags, f)
+			}
+		}
+	}
+
+	return flags
+}
+
+type sampleWriter interface {
+	write(w io.Writer, section []string, flags []*kong.Flag) error
+}
+
+type yamlSample struct{}
+
+func (yamlSample) write(w io.Writer, section []string, flags []*kong.Flag) error {
+	indent := ""
+
+	if len(section) > 0 {
+		indent = strings.Repeat("  ", len(section)-1)
+		fmt.Fprintf(w, "%s%s:\n", indent, section[len(section)-1])
+		indent += "  "
+	}
+
+	for _, f := range flags {
+		v, err := sampleValue(f)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		writeSampleKey(w, indent, f, f.Name+": "+string(data))
+	}
+
+	return nil
+}
+
+type tomlSample struct{}
+
+func (tomlSample) write(w io.Writer, section []string, flags []*kong.Flag) error {
+	if len(flags) == 0 {
+		return nil
+	}
+
+	if len(section) > 0 {
+		fmt.Fprintf(w, "\n[%s]\n", strings.Join(section, "."))
+	}
+
+	for _, f := range flags {
+		v, err := sampleValue(f)
+		if err != nil {
+			return err
+		}
+
+		s, err := tomlValue(v)
+		if err != nil {
+			return err
+		}
+
+		writeSampleKey(w, "", f, f.Name+" = "+s)
+	}
+
+	return nil
+}
+
+type iniSample struct{}
+
+func (iniSample) write(w io.Writer, section []string, flags []*kong.Flag) error {
+	if len(flags) == 0 {
+		return nil
+	}
+
+	if len(section) > 0 {
+		fmt.Fprintf(w, "\n[%s]\n", strings.Join(section, "."))
+	}
+
+	for _, f := range flags {
+		v, err := flatSampleValue(f)
+		if err != nil {
+			return err
+		}
+
+		if strings.ContainsAny(v, `;#"'`) || strings.TrimSpace(v) != v {
+			v = strconv.Quote(v)
+		}
+
+		writeSampleKey(w, "", f, f.Name+" = "+v)
+	}
+
+	return nil
+}
+
+type propertiesSample struct{}
+
+func (propertiesSample) write(w io.Writer, section []string, flags []*kong.Flag) error {
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+
+	for _, f := range flags {
+		v, err := flatSampleValue(f)
+		if err != nil {
+			return err
+		}
+
+		v = r.Replace(v)
+		if strings.HasPrefix(v, " ") {
+			v = `\` + v
+		}
+
+		writeSampleKey(w, "", f, strings.Join(append(section[:len(section):len(section)], f.Name), ".")+"="+v)
+	}
+
+	return nil
+}
+
+// flatSampleValue returns the default of a flag as string. Lists and maps
+// are written as on the command line.
+func flatSampleValue(f *kong.Flag) (string, error) {
+	if f.IsSlice() || f.IsMap() {
+		return f.Default, nil
+	}
+
+	v, err := sampleValue(f)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprint(v), nil
+}
+
+func writeSampleKey(w io.Writer, indent string, f *kong.Flag, line string) {
+	for l := range strings.SplitSeq(f.Help, "\n") {
+		if l != "" {
+			fmt.Fprintf(w, "%s# %s\n", indent, l)
+		}
+	}
+
+	if isSensitive(f.Value) {
+		line = "# " + line
+	}
+
+	fmt.Fprintf(w, "%s%s\n", indent, line)
+}
+
+// sampleValue converts the default of a flag to a value of the matching kind.
+func sampleValue(f *kong.Flag) (any, error) {
+	switch {
+	case f.IsCounter():
+		return parseNumber(f.Default, reflect.Int)
+	case f.IsBool():
+		if f.Default == "" {
+			return false, nil
+		}
+
+		return strconv.ParseBool(f.Default)
+	case f.IsSlice():
+		l := []any{}
+
+		for _, s := range splitDefault(f.Default, f.Tag.Sep) {
+			l = append(l, s)
+		}
+
+		return l, nil
+	case f.IsMap():
+		m := map[string]any{}
+
+		for _, s := range splitDefault(f.Default, f.Tag.MapSep) {
+			k, v, _ := strings.Cut(s, "=")
+			m[k] = v
+		}
+
+		return m, nil
+	}
+
+	if isNumber(f.Target.Kind()) && typeName(f.Value) != "duration" {
+		return parseNumber(f.Default, f.Target.Kind())
+	}
+
+	return f.Default, nil
+}
+
+func isNumber(kind reflect.Kind) bool {
+	return reflect.Int <= kind && kind <= reflect.Float64
+}
+
+func parseNumber(s string, kind reflect.Kind) (any, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	if kind == reflect.Float32 || kind == reflect.Float64 {
+		return strconv.ParseFloat(s, 64)
+	}
+
+	return strconv.ParseInt(s, 0, 64)
+}
+
+func splitDefault(s string, sep rune) []string {
+	if s == "" {
+		return nil
+	}
+
+	if sep == -1 {
+		return []string{s}
+	}
+
+	return strings.Split(s, string(sep))
+}
+
+func tomlValue(v any) (string, error) {
+	switch v := v.(type) {
+	case []any:
+		items := make([]string, 0, len(v))
+
+		for _, i := range v {
+			s, err := tomlValue(i)
+			if err != nil {
+				return "", err
+			}
+
+			items = append(items, s)
+		}
+
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		items := make([]string, 0, len(v))
+
+		for _, k := range keys {
+			s, err := tomlValue(v[k])
+			if err != nil {
+				return "", err
+			}
+
+			items = append(items, strconv.Quote(k)+" = "+s)
+		}
+
+		if len(items) == 0 {
+			return "{}", nil
+		}
+
+		return "{ " + strings.Join(items, ", ") + " }", nil
+	default:
+		data, err := json.Marshal(v)
+
+		return string(data), err
+	}
+}
@@ -0,0 +1,296 @@
+package king
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+const (
+	jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+	durationPattern = `^[-+]?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$`
+)
+
+// JSONSchemaFlag prints the JSON Schema of the configuration file.
+type JSONSchemaFlag bool
+
+// BeforeApply is the actual json-schema command.
+func (j JSONSchemaFlag) BeforeApply(app *kong.Kong) error {
+	data, err := json.MarshalIndent(JSONSchema(app.Model), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if _, err := app.Stdout.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	app.Exit(0)
+
+	return nil
+}
+
+// Schema is a JSON Schema (draft 2020-12).
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+}
+
+// JSONSchema returns the JSON Schema of the configuration file of the application.
+//
+// The schema follows the lookup rules of the file resolvers: flags of commands
+// are accepted in the section of the command and in all sections of its
+// parent commands. Required flags are marked as required in the section of
+// their command. Keys in snake and camel case, aliases of `config:""` tags
+// and nested sections of keys with dashes ("db-host" as "db.host") are
+// accepted as well, all other keys are rejected.
+//
+// If profiles are enabled, the profiles section accepts the same keys as
+// the top level. If includes are enabled, the extends and include keys are
+// accepted and no key is required, as it can be set by an included file.
+func JSONSchema(app *kong.Application) *Schema {
+	s := sectionSchema(app.Node)
+
+	if app.Vars()[includesKey] == "true" {
+		optional(s)
+
+		for _, key := range includeKeys {
+			s.Properties[key] = &Schema{
+				Description: "Configuration files to include, relative to this file.",
+				AnyOf: []*Schema{
+					{Type: "string"},
+					{Type: "array", Items: &Schema{Type: "string"}},
+				},
+			}
+		}
+	}
+
+	if app.Vars()[profilesKey] == "true" {
+		profile := sectionSchema(app.Node)
+		profile.Description = "A profile, its keys override the top level keys."
+		optional(profile)
+		profile.Properties[inheritsKey] = &Schema{Type: "string", Description: "Profile to inherit keys from."}
+
+		s.Properties[profilesSection] = &Schema{
+			Type:                 "object",
+			Description:          "Profiles selected with --profile.",
+			AdditionalProperties: profile,
+		}
+	}
+
+	s.Schema = jsonSchemaDraft
+	s.Title = app.Name
+	s.Description = app.Help
+
+	return s
+}
+
+func sectionSchema(node *kong.Node) *Schema {
+	s := objectSchema(node.Help)
+
+	for _, child := range node.Children {
+		if child.Type != kong.CommandNode || len(configurableFlags(child, true)) == 0 {
+			continue
+		}
+
+		s.Properties[child.Name] = sectionSchema(child)
+	}
+
+	for _, f := range configurableFlags(node, true) {
+		fs := flagSchema(f)
+
+		for _, name := range keyNames(f) {
+			addKey(s, name, fs)
+		}
+	}
+
+	for _, f := range configurableFlags(node, false) {
+		if !f.Required {
+			continue
+		}
+
+		keys := []string{}
+		for _, name := range keyNames(f) {
+			keys = append(keys, addKey(s, name, nil)...)
+		}
+
+		if len(keys) == 1 {
+			s.Required = append(s.Required, keys[0])
+			continue
+		}
+
+		one := &Schema{}
+		for _, k := range keys {
+			one.AnyOf = append(one.AnyOf, &Schema{Required: []string{k}})
+		}
+
+		s.AllOf = append(s.AllOf, one)
+	}
+
+	return s
+}
+
+func objectSchema(description string) *Schema {
+	return &Schema{
+		Type:                 "object",
+		Description:          description,
+		Properties:           map[string]*Schema{},
+		AdditionalProperties: false,
+	}
+}
+
+// addKey adds the property fs for the key in kebab case and its variants
+// in snake and camel case to the section s. A key with dashes is added to
+// nested sections too, "db-host" as "host" in the section "db". It returns
+// the keys of s that can set the property. If fs is nil, the keys are only
+// returned.
+func addKey(s *Schema, key string, fs *Schema) []string {
+	keys := keyVariants(key)
+
+	if fs != nil {
+		for _, k := range keys {
+			s.Properties[k] = fs
+		}
+	}
+
+	for i := range len(key) {
+		if key[i] != '-' {
+			continue
+		}
+
+		for _, prefix := range keyVariants(key[:i]) {
+			sub, ok := s.Properties[prefix]
+
+			switch {
+			case !ok && fs == nil:
+				continue
+			case !ok:
+				sub = objectSchema("")
+				s.Properties[prefix] = sub
+			case sub.Properties == nil:
+				// The prefix is a flag, it can not be a section.
+				continue
+			}
+
+			addKey(sub, key[i+1:], fs)
+
+			if !slices.Contains(keys, prefix) {
+				keys = append(keys, prefix)
+			}
+		}
+	}
+
+	return keys
+}
+
+// keyVariants returns key in kebab, snake and camel case.
+func keyVariants(key string) []string {
+	keys := []string{key}
+
+	camel := []byte{}
+	for i := 0; i < len(key); i++ {
+		if key[i] == '-' && i+1 < len(key) {
+			i++
+			camel = append(camel, []byte(strings.ToUpper(key[i:i+1]))...)
+
+			continue
+		}
+
+		camel = append(camel, key[i])
+	}
+
+	for _, k := range []string{strings.ReplaceAll(key, "-", "_"), string(camel)} {
+		if !slices.Contains(keys, k) && normalizeKey(k) == key {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// optional removes the required keys of s and all its sections.
+func optional(s *Schema) {
+	s.Required = nil
+	s.AllOf = nil
+
+	for _, p := range s.Properties {
+		optional(p)
+	}
+}
+
+func flagSchema(f *kong.Flag) *Schema {
+	var s *Schema
+
+	switch {
+	case f.IsCounter():
+		s = &Schema{Type: "integer", Minimum: new(int)}
+	case f.IsBool():
+		s = &Schema{Type: "boolean"}
+	case f.IsSlice():
+		s = &Schema{Type: "array", Items: typeSchema(f.Target.Type().Elem())}
+		s.Items.Enum = enum(f.Value)
+	case f.IsMap():
+		s = &Schema{Type: "object", AdditionalProperties: typeSchema(f.Target.Type().Elem())}
+	default:
+		s = typeSchema(f.Target.Type())
+		s.Enum = enum(f.Value)
+	}
+
+	s.Description = f.Help
+
+	if f.HasDefault {
+		if v, err := sampleValue(f); err == nil {
+			s.Default = v
+		}
+	}
+
+	return s
+}
+
+func typeSchema(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == reflect.TypeOf(time.Duration(0)):
+		return &Schema{Type: "string", Pattern: durationPattern}
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &Schema{Type: "number"}
+	case isNumber(t.Kind()):
+		return &Schema{Type: "integer"}
+	default:
+		return &Schema{Type: "string"}
+	}
+}
+
+func enum(value *kong.Value) []any {
+	if value.Enum == "" {
+		return nil
+	}
+
+	e := []any{}
+	for _, v := range value.EnumSlice() {
+		e = append(e, v)
+	}
+
+	return e
+}
@@ -0,0 +1,155 @@
+package king
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// SecretProvider resolves references to secrets in configuration files.
+//
+// A reference is a value of the form <scheme>://<ref>. The provider
+// registered for the scheme in Config.SecretProviders gets the part after
+// "://", for example "/run/secrets/db" for "file:///run/secrets/db".
+type SecretProvider interface {
+	Secret(ref string) (string, error)
+}
+
+// SecretProviderFunc is a function that implements SecretProvider.
+type SecretProviderFunc func(ref string) (string, error)
+
+// Secret implements SecretProvider.
+func (f SecretProviderFunc) Secret(ref string) (string, error) {
+	return f(ref)
+}
+
+// DefaultSecretProviders returns the providers for the schemes file, env
+// and exec.
+func DefaultSecretProviders() map[string]SecretProvider {
+	return map[string]SecretProvider{
+		"file": FileSecretProvider(),
+		"env":  EnvSecretProvider(),
+		"exec": ExecSecretProvider(),
+	}
+}
+
+// FileSecretProvider reads the secret from a file. Trailing newlines are
+// removed.
+func FileSecretProvider() SecretProvider {
+	return SecretProviderFunc(func(ref string) (string, error) {
+		data, err := os.ReadFile(filepath.Clean(kong.ExpandPath(ref)))
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(data), "\r\n"), nil
+	})
+}
+
+// EnvSecretProvider reads the secret from an environment variable.
+func EnvSecretProvider() SecretProvider {
+	return SecretProviderFunc(func(ref string) (string, error) {
+		v, ok := os.LookupEnv(ref)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s not set", ref)
+		}
+
+		return v, nil
+	})
+}
+
+// ExecSecretProvider runs a command and uses its output as secret. The
+// command is split on white space, it is not run by a shell. Trailing
+// newlines are removed.
+func ExecSecretProvider() SecretProvider {
+	return SecretProviderFunc(func(ref string) (string, error) {
+		args := strings.Fields(ref)
+		if len(args) == 0 {
+			return "", errors.New("no command")
+		}
+
+		// nolint: gosec
+		cmd := exec.Command(args[0], args[1:]...)
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+
+		out, err := cmd.Output()
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return "", fmt.Errorf("%s: %w: %s", args[0], err, msg)
+			}
+
+			return "", fmt.Errorf("%s: %w", args[0], err)
+		}
+
+		return strings.TrimRight(string(out), "\r\n"), nil
+	})
+}
+
+// MapSecretProvider is an in-memory SecretProvider, the references are the
+// keys of the map.
+type MapSecretProvider map[string]string
+
+// Secret implements SecretProvider.
+func (m MapSecretProvider) Secret(ref string) (string, error) {
+	v, ok := m[ref]
+	if !ok {
+		return "", fmt.Errorf("secret %q not found", ref)
+	}
+
+	return v, nil
+}
+
+// secretResolver replaces references to secrets in the values of a
+// configuration file and marks the flags as sensitive.
+type secretResolver struct {
+	kong.Resolver
+	path      string
+	providers map[string]SecretProvider
+	tracker   *tracker
+}
+
+func (r secretResolver) Resolve(ctx *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
+	v, err := r.Resolver.Resolve(ctx, parent, flag)
+	if err != nil || v == nil {
+		return v, err
+	}
+
+	sensitive := false
+
+	v, err = mapStrings(v, func(s string) (string, error) {
+		scheme, ref, ok := strings.Cut(s, "://")
+		if !ok {
+			return s, nil
+		}
+
+		p, ok := r.providers[scheme]
+		if !ok {
+			return s, nil
+		}
+
+		sensitive = true
+
+		secret, err := p.Secret(ref)
+		if err != nil {
+			return "", fmt.Errorf("%s secret: %w", scheme, err)
+		}
+
+		return secret, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", r.path, flag.Name, err)
+	}
+
+	if sensitive {
+		r.tracker.markSensitive(ctx, flag.Name)
+	}
+
+	return v, nil
+}
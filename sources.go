@@ -0,0 +1,80 @@
+package king
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+const sourcesTag = "sources"
+
+// allSources are the sources that can be used in a `sources:""` tag.
+var allSources = []string{SourceFlag, SourceEnv, SourceDotEnv, SourceFile, SourceDirectory}
+
+// alwaysAllowed are the sources that can set every flag.
+var alwaysAllowed = []string{SourceDefault, SourceEmbedded, SourcePolicy}
+
+// checkSources returns a kong BeforeApply hook that checks the origin of
+// flags with a `sources:""` tag. The tag limits the sources a flag can be
+// set from, a token can be restricted to the environment and configuration
+// files with `sources:"env,file"`. Violations are handled according to e,
+// defaults, the embedded configuration and policy files are always allowed.
+//
+// Flags with a `sensitive:""` tag that are set on the command line cause a
+// warning, as the command line is visible to other users.
+func checkSources(e Enforcement) func(*kong.Context, *kong.Path) error {
+	return func(ctx *kong.Context, path *kong.Path) error {
+		if path.App == nil {
+			return nil
+		}
+
+		t := trackerFor(ctx)
+
+		for _, f := range ctx.Flags() {
+			allowed, err := flagSources(f)
+			if err != nil {
+				return err
+			}
+
+			o := originOf(ctx, t, f)
+
+			if o.Source == SourceFlag && isSensitive(f.Value) {
+				fmt.Fprintf(ctx.Stderr, "warning: --%s is sensitive and should not be set on the command line\n", f.Name)
+			}
+
+			if allowed == nil || slices.Contains(allowed, o.Source) || slices.Contains(alwaysAllowed, o.Source) {
+				continue
+			}
+
+			msg := fmt.Sprintf("--%s must not be set by %s (allowed sources: %s)", f.Name, o, strings.Join(allowed, ", "))
+			if err := e.enforce(ctx, msg); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// flagSources returns the sources of the `sources:""` tag of flag or nil.
+func flagSources(flag *kong.Flag) ([]string, error) {
+	tag := flag.Tag.Get(sourcesTag)
+	if tag == "" {
+		return nil, nil
+	}
+
+	sources := []string{}
+
+	for s := range strings.SplitSeq(tag, ",") {
+		s = strings.TrimSpace(s)
+		if !slices.Contains(allSources, s) {
+			return nil, fmt.Errorf("%s: unknown source %q", flag.ShortSummary(), s)
+		}
+
+		sources = append(sources, s)
+	}
+
+	return sources, nil
+}
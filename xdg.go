@@ -0,0 +1,96 @@
+package king
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// ConfigDir returns the user configuration directory of the application
+// ($XDG_CONFIG_HOME/<name>, defaults to ~/.config/<name>).
+func (c Config) ConfigDir() string {
+	return filepath.Join(xdgHome("XDG_CONFIG_HOME", ".config"), c.Name)
+}
+
+// DataDir returns the user data directory of the application
+// ($XDG_DATA_HOME/<name>, defaults to ~/.local/share/<name>).
+func (c Config) DataDir() string {
+	return filepath.Join(xdgHome("XDG_DATA_HOME", ".local/share"), c.Name)
+}
+
+// CacheDir returns the user cache directory of the application
+// ($XDG_CACHE_HOME/<name>, defaults to ~/.cache/<name>).
+func (c Config) CacheDir() string {
+	return filepath.Join(xdgHome("XDG_CACHE_HOME", ".cache"), c.Name)
+}
+
+// StateDir returns the user state directory of the application
+// ($XDG_STATE_HOME/<name>, defaults to ~/.local/state/<name>).
+func (c Config) StateDir() string {
+	return filepath.Join(xdgHome("XDG_STATE_HOME", ".local/state"), c.Name)
+}
+
+// RuntimeDir returns the user runtime directory of the application
+// ($XDG_RUNTIME_DIR/<name>, defaults to the temporary directory).
+func (c Config) RuntimeDir() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if !filepath.IsAbs(dir) {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, c.Name)
+}
+
+// defaultConfigPaths returns the configuration files of the application
+// according to the XDG Base Directory Specification, ordered from the least
+// to the most important, as values of later files override values of
+// earlier files:
+//
+//	/etc/<name>/config.<ext>
+//	$XDG_CONFIG_DIRS/<name>/config.<ext> (defaults to /etc/xdg)
+//	$XDG_CONFIG_HOME/<name>/config.<ext> (defaults to ~/.config)
+//	./<name>.<ext>
+//
+// The extension depends on the FileResolver.
+func (c Config) defaultConfigPaths() []string {
+	ext := c.FileResolver.extension()
+	file := "config." + ext
+	paths := []string{filepath.Join("/etc", c.Name, file)}
+
+	dirs := xdgDirs("XDG_CONFIG_DIRS", "/etc/xdg")
+	for i := len(dirs) - 1; i >= 0; i-- {
+		paths = append(paths, filepath.Join(dirs[i], c.Name, file))
+	}
+
+	return append(paths, filepath.Join(c.ConfigDir(), file), "./"+c.Name+"."+ext)
+}
+
+// xdgHome returns the directory of env or ~/fallback if env is not set or
+// not absolute.
+func xdgHome(env, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+
+	return kong.ExpandPath("~/" + fallback)
+}
+
+// xdgDirs returns the absolute directories of the colon separated list in
+// env or fallback if there are none.
+func xdgDirs(env, fallback string) []string {
+	dirs := []string{}
+
+	for dir := range strings.SplitSeq(os.Getenv(env), ":") {
+		if filepath.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	if len(dirs) == 0 {
+		return []string{fallback}
+	}
+
+	return dirs
+}